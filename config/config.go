@@ -1,10 +1,16 @@
 package config
 
 import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/adrg/xdg"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -24,10 +30,15 @@ const (
 type model struct {
 	client *jellyfin.Client
 
+	server  int    // index into servers or addServer
+	newName string // name for the profile if it's a new one
+
 	unhidden bool
 	inputs   []textinput.Model
 	focused  int
 	err      error
+
+	quickConnect *jellyfin.QuickConnect // waiting for the code to be approved
 }
 
 func (m model) Init() tea.Cmd {
@@ -44,10 +55,38 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case unhideForm:
 		m.unhidden = true
 		return m, textinput.Blink
+	case quickConnectStarted:
+		m.err = nil
+		m.quickConnect = msg.qc
+		return m, pollQuickConnect(msg.qc)
+	case quickConnectApproved:
+		if m.quickConnect == nil {
+			// canceled
+			return m, nil
+		}
+		return m, m.finishQuickConnect(msg)
+	case quickConnectPending:
+		if msg.qc != m.quickConnect {
+			// canceled
+			return m, nil
+		}
+		return m, pollQuickConnect(msg.qc)
 	case tea.KeyMsg:
+		if m.quickConnect != nil {
+			switch msg.Type {
+			case tea.KeyCtrlC:
+				return m, tea.Quit
+			case tea.KeyEsc:
+				m.quickConnect = nil
+			}
+			return m, nil
+		}
 		switch msg.Type {
 		case tea.KeyEnter:
 			if m.focused == len(m.inputs)-1 {
+				if m.inputs[host].Value() != "" && m.inputs[username].Value() == "" && m.inputs[password].Value() == "" {
+					return m, m.startQuickConnect
+				}
 				return m, m.initClient
 			}
 			m.focused = (m.focused + 1) % len(m.inputs)
@@ -69,7 +108,12 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	// We handle errors just like any other message
 	case error:
+		if errors.Is(msg, jellyfin.ErrQuickConnectDisabled) {
+			msg = errors.New("Quick Connect is disabled on this server, log in with your username and password")
+		}
 		m.err = msg
+		m.unhidden = true // the error would be invisible otherwise
+		m.quickConnect = nil
 		return m, nil
 	}
 
@@ -90,6 +134,11 @@ func (m model) View() string {
 	doc := strings.Builder{}
 	doc.WriteString(" Jellyfin\n")
 	doc.WriteString("\n")
+	if m.quickConnect != nil {
+		doc.WriteString(" Enter the code " + textStyle.Render(m.quickConnect.Code) + " under Quick Connect in the settings of the Jellyfin web UI\n\n")
+		doc.WriteString(" Waiting for approval, esc to cancel\n")
+		return doc.String()
+	}
 	doc.WriteString(" " + textStyle.Render("Host") + "\n")
 	doc.WriteString(" " + m.inputs[host].View() + "\n")
 	if m.inputs[host].Err != nil {
@@ -108,85 +157,285 @@ func (m model) View() string {
 		doc.WriteString(" " + m.inputs[password].Err.Error() + "\n")
 	}
 	doc.WriteString("\n")
+	doc.WriteString(" Leave username and password empty to log in with Quick Connect\n\n")
 	if m.err != nil {
-		doc.WriteString(" " + m.err.Error() + "\n\n")
+		doc.WriteString(" " + jellyfin.Redact(m.err.Error()) + "\n\n")
 	}
 	return doc.String()
 }
 
 var jfClient *jellyfin.Client
 
+// Sent to the server with device_name, client_name and client_version override jfsh's own
+var clientName, clientVersion string
+
 type unhideForm struct{}
 
 func (m model) initClient() tea.Msg {
-	for _, input := range m.inputs {
-		if input.Err != nil || input.Value() == "" {
+	var profile server
+	if m.server != addServer {
+		profile = servers[m.server]
+	}
+	// an api key replaces the session token and doesn't need a username or password
+	token := profile.ApiKey
+	if token == "" {
+		token = profile.Token
+	}
+	for i, input := range m.inputs {
+		if input.Err != nil {
+			return unhideForm{}
+		}
+		if input.Value() == "" && (i == host || token == "") {
 			return unhideForm{}
 		}
 	}
 	host, username, password := m.inputs[host].Value(), m.inputs[username].Value(), m.inputs[password].Value()
-	client, err := jellyfin.NewClient(
-		host,
-		username,
-		password,
-		viper.GetString("client_name"),
-		viper.GetString("device"),
+	newClient := func(token, userId string) (*jellyfin.Client, error) {
+		return jellyfin.NewClient(
+			host,
+			username,
+			password,
+			clientName,
+			viper.GetString("device_name"),
+			viper.GetString("device_id"),
+			clientVersion,
+			token,
+			userId,
+		)
+	}
+	client, err := newClient(token, profile.UserId)
+	if errors.Is(err, jellyfin.ErrInvalidToken) && profile.ApiKey == "" && password != "" {
+		// stored session expired, log in again
+		client, err = newClient("", "")
+	} else if errors.Is(err, jellyfin.ErrInvalidToken) && profile.ApiKey == "" {
+		err = errors.New("The session expired, enter your password to log in again")
+	}
+	if err != nil {
+		return err
+	}
+	m.saveClient(client, profile)
+	return tea.Quit()
+}
+
+// Remembers the login in the profile
+func (m model) saveClient(client *jellyfin.Client, profile server) {
+	jfClient = client
+	profile.Host = m.inputs[host].Value()
+	profile.Username = m.inputs[username].Value()
+	profile.UserId = client.UserId
+	if profile.ApiKey == "" {
+		profile.Token = client.Token
+	}
+	// the token is enough from now on, the password isn't kept in plain text
+	profile.Password = ""
+	if m.server == addServer {
+		profile.Name = m.newName
+		if profile.Name == "" {
+			profile.Name = nameFromHost(profile.Host)
+		}
+		servers = append(servers, profile)
+	} else {
+		servers[m.server] = profile
+	}
+	if err := saveServers(); err != nil {
+		// logged in anyway, it's asked for again next time
+		slog.Error("failed to save the server profile", "err", err)
+	}
+}
+
+type (
+	quickConnectStarted struct{ qc *jellyfin.QuickConnect }
+	quickConnectPending struct{ qc *jellyfin.QuickConnect }
+)
+
+func (m model) startQuickConnect() tea.Msg {
+	qc, err := jellyfin.InitiateQuickConnect(
+		m.inputs[host].Value(),
+		clientName,
+		viper.GetString("device_name"),
 		viper.GetString("device_id"),
-		viper.GetString("client_version"),
-		viper.GetString("token"),
-		viper.GetString("userId"),
+		clientVersion,
 	)
 	if err != nil {
 		return err
 	}
-	jfClient = client
-	viper.Set("host", host)
-	viper.Set("username", username)
-	viper.Set("password", password)
-	viper.Set("userId", client.UserId)
-	viper.Set("token", client.Token)
-	viper.WriteConfig()
-	viper.SafeWriteConfig()
-	return tea.Quit()
+	return quickConnectStarted{qc}
 }
 
-func Run(clientName, clientVersion, cfgPath string) *jellyfin.Client {
+// Checks every few seconds whether the code was approved, and logs in once it is
+func pollQuickConnect(qc *jellyfin.QuickConnect) tea.Cmd {
+	return tea.Tick(3*time.Second, func(time.Time) tea.Msg {
+		token, userId, ok, err := qc.Check()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return quickConnectPending{qc}
+		}
+		return quickConnectApproved{token, userId}
+	})
+}
+
+type quickConnectApproved struct{ token, userId string }
+
+func (m model) finishQuickConnect(msg quickConnectApproved) tea.Cmd {
+	return func() tea.Msg {
+		client, err := jellyfin.NewClient(
+			m.inputs[host].Value(),
+			"",
+			"",
+			clientName,
+			viper.GetString("device_name"),
+			viper.GetString("device_id"),
+			clientVersion,
+			msg.token,
+			msg.userId,
+		)
+		if err != nil {
+			return err
+		}
+		var profile server
+		if m.server != addServer {
+			profile = servers[m.server]
+		}
+		profile.ApiKey = "" // the quick connect token is a session token
+		m.saveClient(client, profile)
+		return tea.Quit()
+	}
+}
+
+// Reads the config file and sets the defaults, without logging in
+func Load(cfgPath string) {
 	viper.AddConfigPath(filepath.Join(xdg.ConfigHome, "jfsh"))
 	viper.SetConfigName("jfsh")
 	viper.SetConfigType("yaml")
 	viper.SetConfigFile(cfgPath) // doesn't override if cfgPath is empty
 	viper.ReadInConfig()
-	viper.Set("client_name", clientName)
-	deviceId := viper.GetString("device_id")
-	if deviceId == "" {
-		deviceId = uuid.NewString()
-		viper.Set("device_id", deviceId)
+	migrate()
+	viper.SetDefault("progress_interval_seconds", 3)
+	viper.SetDefault("mpv_path", "mpv")
+	viper.SetDefault("playback_speed", 1.0)
+	viper.SetDefault("repeat", "off")
+	viper.SetDefault("playlist_window", 25)
+	viper.SetDefault("mpris", true)
+	viper.SetDefault("cache_ttl_seconds", 60)
+	viper.SetDefault("latest_limit", 30)
+	viper.SetDefault("search_limit", 50)
+	viper.SetDefault("api_retries", 3)
+	viper.SetDefault("api_timeout_seconds", 30)
+	viper.SetDefault("remember_series_tracks", true)
+	viper.SetDefault("resume_rewind_seconds", 5)
+	viper.SetDefault("autoqueue", true)
+	viper.SetDefault("autoplay_next", true)
+	viper.SetDefault("watched_threshold", 90)
+	viper.SetDefault("remote_control", true)
+	viper.SetDefault("prefer_full_subs", true)
+	viper.SetDefault("skip_mode", "auto")
+	viper.SetDefault("download_dir", filepath.Join(xdg.UserDirs.Download, "jfsh"))
+	viper.SetDefault("title_format.movie", "{name} ({year})")
+	viper.SetDefault("title_format.episode", "{series} S{season}E{episode} {name}")
+	viper.SetDefault("skip_chapters", []string{"^intro$", "^opening$"})
+	hostname, _ := os.Hostname()
+	viper.SetDefault("device_name", hostname)
+}
+
+// Sets the keys and writes only them to the config file. viper.WriteConfig would write every default too,
+// and then a default that changes in a release never reaches anyone who saved a setting
+func Save(values map[string]any) error {
+	for key, value := range values {
+		viper.Set(key, value)
+	}
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		path = filepath.Join(xdg.ConfigHome, "jfsh", "jfsh.yaml")
+	}
+	file := viper.New()
+	file.SetConfigFile(path)
+	file.SetConfigType("yaml")
+	err := file.ReadInConfig()
+	missing := errors.Is(err, fs.ErrNotExist)
+	if err != nil && !missing {
+		return err
+	}
+	for key, value := range values {
+		file.Set(key, value)
+	}
+	if !missing {
+		return file.WriteConfig()
 	}
-	device := viper.GetString("device")
-	if device == "" {
-		device, _ = os.Hostname()
-		viper.Set("device", device)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := file.SafeWriteConfigAs(path); err != nil {
+		return err
+	}
+	// it's the config file from now on
+	viper.SetConfigFile(path)
+	return nil
+}
+
+// serverName selects a profile without asking, a name that doesn't exist yet adds a new profile with that name.
+// The client is nil without an error if the user quit
+func Run(name, version, cfgPath, serverName string) (*jellyfin.Client, error) {
+	Load(cfgPath)
+	clientName, clientVersion = cmp.Or(viper.GetString("client_name"), name), cmp.Or(viper.GetString("client_version"), version)
+	// a new id shows up as another device on the server, so it's written right away
+	if viper.GetString("device_id") == "" {
+		if err := Save(map[string]any{"device_id": uuid.NewString()}); err != nil {
+			slog.Error("failed to save device_id", "err", err)
+		}
+	}
+
+	if err := jellyfin.ConfigureTLS(viper.GetBool("insecure_skip_verify"), viper.GetString("ca_cert")); err != nil {
+		return nil, fmt.Errorf("failed to load ca_cert: %w", err)
+	}
+
+	loadServers()
+	m := model{server: addServer}
+	switch {
+	case serverName != "":
+		m.newName = serverName
+		for i, s := range servers {
+			if s.Name == serverName {
+				m.server = i
+			}
+		}
+	case len(servers) == 1:
+		m.server = 0
+	case len(servers) > 1:
+		choice, ok, err := pickServer()
+		if err != nil || !ok {
+			return nil, err
+		}
+		m.server = choice
+	}
+	var profile server
+	if m.server != addServer {
+		profile = servers[m.server]
 	}
-	viper.Set("client_version", clientVersion)
 
 	form := make([]textinput.Model, 3)
 	form[host] = textinput.New()
 	form[host].Focus()
-	form[host].SetValue(viper.GetString("host"))
+	form[host].SetValue(profile.Host)
 	form[host].Validate = func(s string) error {
 		_, err := url.Parse(s) // this never seems to err
 		return err
 	}
 
 	form[username] = textinput.New()
-	form[username].SetValue(viper.GetString("username"))
+	form[username].SetValue(profile.Username)
 
 	form[password] = textinput.New()
-	form[password].SetValue(viper.GetString("password"))
+	form[password].SetValue(profile.Password)
 
-	m := model{inputs: form}
+	m.inputs = form
 	if _, err := tea.NewProgram(m).Run(); err != nil {
-		panic(err)
+		return nil, err
+	}
+	if jfClient != nil {
+		jfClient.SetRetries(viper.GetInt("api_retries"))
+		jfClient.SetTimeout(time.Duration(viper.GetInt("api_timeout_seconds")) * time.Second)
 	}
-	return jfClient
+	return jfClient, nil
 }
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Bumped with a new migration whenever a key is renamed or removed
+const configVersion = 3
+
+// migrations[i] upgrades a config from version i to i+1
+var migrations = []func(){
+	// the login used to be top level keys instead of a list of server profiles
+	func() {
+		loadServers()
+		setServers()
+	},
+	// device held the device name
+	func() {
+		if device := viper.GetString("device"); device != "" && viper.GetString("device_name") == "" {
+			viper.Set("device_name", device)
+		}
+		viper.Set("device", "")
+	},
+	// client_name and client_version were jfsh's own and got written back, they only override it now
+	func() {
+		viper.Set("client_name", "")
+		viper.Set("client_version", "")
+	},
+}
+
+// Top level keys jfsh knows about, anything else is probably a typo or left over from an old version
+var knownKeys = []string{
+	"api_retries",
+	"api_timeout_seconds",
+	"audio_device",
+	"autoplay_next",
+	"autoqueue",
+	"ca_cert",
+	"cache_ttl_seconds",
+	"client_name",
+	"client_version",
+	"config_version",
+	"device_id",
+	"device_name",
+	"discord_client_id",
+	"discord_presence",
+	"download_dir",
+	"force_transcode",
+	"forced_subs_only",
+	"hdr_tonemap",
+	"images",
+	"insecure_skip_verify",
+	"keybindings",
+	"latest_limit",
+	"max_bitrate",
+	"media_version",
+	"mpris",
+	"mpris_plugin",
+	"mpv_args",
+	"mpv_path",
+	"osd_info",
+	"panscan",
+	"playback_speed",
+	"playlist_window",
+	"prefer_full_subs",
+	"progress_interval_seconds",
+	"remember_series_tracks",
+	"remote_control",
+	"repeat",
+	"resume_rewind_seconds",
+	"search_limit",
+	"servers",
+	"shuffle",
+	"skip_chapters",
+	"skip_mode",
+	"skip_padding_seconds",
+	"sort_by",
+	"sort_descending",
+	"sub_langs",
+	"subtitle_codepage",
+	"theme",
+	"theme_colors",
+	"title_format",
+	"trakt_client_id",
+	"trakt_token",
+	"unwatched_only",
+	"video_aspect_override",
+	"watched_threshold",
+	"window_mode",
+	// emptied by migrations, viper can't remove keys
+	"host", "username", "password", "api_key", "token", "userid", "device",
+}
+
+// Upgrades an older config and writes it back, then warns about keys that aren't used
+func migrate() {
+	// migrations don't mind running on a config that's already up to date, so a missing version is fine
+	if version := viper.GetInt("config_version"); version < configVersion && viper.ConfigFileUsed() != "" {
+		for _, migration := range migrations[version:] {
+			migration()
+		}
+		viper.Set("config_version", configVersion)
+		if err := viper.WriteConfig(); err != nil {
+			slog.Error("failed to write migrated config", "err", err)
+		}
+	}
+	for _, key := range viper.AllKeys() {
+		top, _, _ := strings.Cut(key, ".")
+		if !slices.Contains(knownKeys, top) {
+			slog.Warn("unknown config key", "key", key)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"net/url"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/viper"
+)
+
+// Named server profile, stored as a list under the `servers` key
+type server struct {
+	Name     string `mapstructure:"name" yaml:"name"`
+	Host     string `mapstructure:"host" yaml:"host"`
+	Username string `mapstructure:"username" yaml:"username"`
+	Password string `mapstructure:"password" yaml:"password"`
+	ApiKey   string `mapstructure:"api_key" yaml:"api_key,omitempty"`
+	Token    string `mapstructure:"token" yaml:"token"`
+	UserId   string `mapstructure:"userId" yaml:"userId"`
+}
+
+var servers []server
+
+// Read the profiles from the config, a config from before profiles existed becomes the "default" profile
+func loadServers() {
+	servers = nil
+	viper.UnmarshalKey("servers", &servers)
+	if len(servers) == 0 && viper.GetString("host") != "" {
+		servers = append(servers, server{
+			Name:     "default",
+			Host:     viper.GetString("host"),
+			Username: viper.GetString("username"),
+			Password: viper.GetString("password"),
+			ApiKey:   viper.GetString("api_key"),
+			Token:    viper.GetString("token"),
+			UserId:   viper.GetString("userId"),
+		})
+	}
+}
+
+// The login before there were profiles
+var oldLoginKeys = []string{"host", "username", "password", "api_key", "token", "userId"}
+
+func setServers() {
+	viper.Set("servers", servers)
+	// the old top level keys were moved into a profile, don't leave the secrets lying around
+	for _, key := range oldLoginKeys {
+		if viper.IsSet(key) {
+			viper.Set(key, "")
+		}
+	}
+}
+
+func saveServers() error {
+	values := map[string]any{"servers": servers}
+	for _, key := range oldLoginKeys {
+		if viper.IsSet(key) {
+			values[key] = ""
+		}
+	}
+	return Save(values)
+}
+
+// Profile name for a server that was added without one
+func nameFromHost(host string) string {
+	if u, err := url.Parse(host); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return host
+}
+
+// Implements bubbles/list.Item interface
+type serverItem struct {
+	name, host string
+}
+
+func (i serverItem) Title() string       { return i.name }
+func (i serverItem) Description() string { return i.host }
+func (i serverItem) FilterValue() string { return i.name }
+
+const addServer = -1
+
+// Picks one of the profiles or a new one
+type picker struct {
+	list   list.Model
+	choice *int
+}
+
+func (m picker) Init() tea.Cmd { return nil }
+
+func (m picker) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.list.SetSize(msg.Width-pickerStyle.GetHorizontalFrameSize(), msg.Height-pickerStyle.GetVerticalFrameSize())
+	case tea.KeyMsg:
+		if m.list.SettingFilter() {
+			break
+		}
+		switch msg.String() {
+		case "enter":
+			choice := m.list.Index()
+			if choice >= len(servers) {
+				choice = addServer
+			}
+			*m.choice = choice
+			return m, tea.Quit
+		case "ctrl+c", "esc", "q":
+			return m, tea.Quit
+		}
+	}
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+var pickerStyle = lipgloss.NewStyle().Margin(1, 2)
+
+func (m picker) View() string {
+	return pickerStyle.Render(m.list.View())
+}
+
+// Returns the index of the chosen profile, addServer for a new one, or ok=false if the user quit
+func pickServer() (choice int, ok bool, err error) {
+	items := []list.Item{}
+	for _, s := range servers {
+		items = append(items, serverItem{s.Name, s.Host})
+	}
+	items = append(items, serverItem{"Add server", "Log in to a new server"})
+	l := list.New(items, list.NewDefaultDelegate(), 0, 0)
+	l.Title = "Jellyfin servers"
+
+	chosen := len(servers) + 1 // stays out of range if the user quits
+	m := picker{list: l, choice: &chosen}
+	if _, err := tea.NewProgram(m).Run(); err != nil {
+		return 0, false, err
+	}
+	if chosen > len(servers) {
+		return 0, false, nil
+	}
+	return chosen, true, nil
+}
@@ -0,0 +1,143 @@
+// Minimal Discord Rich Presence client over the local IPC socket of the Discord desktop app
+package discord
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	opHandshake = 0
+	opFrame     = 1
+)
+
+type Presence struct {
+	conn  net.Conn
+	nonce int
+}
+
+// Discord listens on the first free of discord-ipc-0..9 in the runtime or temp dir
+func socketPaths() []string {
+	var dirs []string
+	for _, env := range []string{"XDG_RUNTIME_DIR", "TMPDIR", "TMP", "TEMP"} {
+		if dir := os.Getenv(env); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	dirs = append(dirs, "/tmp")
+	var paths []string
+	for _, dir := range dirs {
+		for i := range 10 {
+			// flatpak and snap installs put the socket in a subdirectory
+			for _, sub := range []string{"", "app/com.discordapp.Discord", "snap.discord"} {
+				paths = append(paths, filepath.Join(dir, sub, "discord-ipc-"+strconv.Itoa(i)))
+			}
+		}
+	}
+	return paths
+}
+
+// Connects to the running Discord app, clientId is the id of the Discord application shown as the activity
+func Connect(clientId string) (*Presence, error) {
+	var conn net.Conn
+	var err error
+	for _, path := range socketPaths() {
+		conn, err = net.DialTimeout("unix", path, time.Second)
+		if err == nil {
+			break
+		}
+	}
+	if conn == nil {
+		return nil, fmt.Errorf("discord is not running: %w", err)
+	}
+	p := &Presence{conn: conn}
+	if err := p.send(opHandshake, map[string]any{"v": 1, "client_id": clientId}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := p.receive(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Presence) send(op uint32, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, op)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	p.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	_, err = p.conn.Write(buf.Bytes())
+	return err
+}
+
+func (p *Presence) receive() (map[string]any, error) {
+	p.conn.SetReadDeadline(time.Now().Add(time.Second))
+	var header [2]uint32
+	if err := binary.Read(p.conn, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	data := make([]byte, header[1])
+	if _, err := io.ReadFull(p.conn, data); err != nil {
+		return nil, err
+	}
+	var res map[string]any
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	if res["evt"] == "ERROR" {
+		return nil, errors.New("discord: " + fmt.Sprint(res["data"]))
+	}
+	return res, nil
+}
+
+func (p *Presence) setActivity(activity any) error {
+	if p == nil {
+		return nil
+	}
+	p.nonce++
+	err := p.send(opFrame, map[string]any{
+		"cmd":   "SET_ACTIVITY",
+		"nonce": strconv.Itoa(p.nonce),
+		"args":  map[string]any{"pid": os.Getpid(), "activity": activity},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = p.receive()
+	return err
+}
+
+// Shows details and state as the activity, with the time elapsed since started unless it's zero
+func (p *Presence) SetActivity(details, state string, started time.Time) error {
+	activity := map[string]any{"details": details, "state": state}
+	if !started.IsZero() {
+		activity["timestamps"] = map[string]any{"start": started.Unix()}
+	}
+	return p.setActivity(activity)
+}
+
+func (p *Presence) Clear() error {
+	return p.setActivity(nil)
+}
+
+func (p *Presence) Close() error {
+	if p == nil {
+		return nil
+	}
+	return p.conn.Close()
+}
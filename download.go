@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/hacel/jfsh/jellyfin"
+	"github.com/hacel/jfsh/mpv"
+	"github.com/sj14/jellyfin-go/api"
+	"github.com/spf13/viper"
+)
+
+type download struct {
+	title    string
+	progress *jellyfin.DownloadProgress
+}
+
+type (
+	downloadTicked   struct{}
+	downloadFinished struct {
+		id, title string
+		err       error
+	}
+)
+
+// Downloads the selected movie or episode into download_dir, it's played from there afterwards
+func (m model) startDownload() (tea.Model, tea.Cmd) {
+	selected, ok := m.list.SelectedItem().(item)
+	if !ok {
+		return m, nil
+	}
+	dto := jellyfin.Item(selected)
+	if t := dto.GetType(); t != api.BASEITEMKIND_MOVIE && t != api.BASEITEMKIND_EPISODE {
+		return m, m.list.NewStatusMessage("Only movies and episodes can be downloaded")
+	}
+	if _, ok := m.downloads[dto.GetId()]; ok || mpv.IsDownloaded(dto) {
+		return m, m.list.NewStatusMessage("Already downloaded")
+	}
+	d := download{selected.Title(), &jellyfin.DownloadProgress{}}
+	m.downloads[dto.GetId()] = d
+	cmds := []tea.Cmd{m.list.NewStatusMessage("Downloading " + d.title), func() tea.Msg {
+		path, err := m.client.DownloadItem(dto, viper.GetString("download_dir"), d.progress)
+		if err == nil {
+			err = mpv.SaveDownload(dto, path)
+		}
+		return downloadFinished{dto.GetId(), d.title, err}
+	}}
+	if len(m.downloads) == 1 {
+		cmds = append(cmds, tickDownloads())
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// Progress is shown as a status message while downloads are running
+func tickDownloads() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return downloadTicked{} })
+}
+
+func (m model) describeDownloads() string {
+	var parts []string
+	for _, d := range m.downloads {
+		parts = append(parts, fmt.Sprintf("%s %.f%%", d.title, d.progress.Percent()))
+	}
+	return "Downloading " + strings.Join(parts, ", ")
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/hacel/jfsh/jellyfin"
+	"github.com/sj14/jellyfin-go/api"
+)
+
+// Types the type filter cycles through, empty for any
+var filterTypes = []api.BaseItemKind{"", api.BASEITEMKIND_MOVIE, api.BASEITEMKIND_EPISODE}
+
+type genresLoaded []string
+
+func (m model) fetchGenres() tea.Msg {
+	genres, err := m.client.GetGenres()
+	if err != nil {
+		return err
+	}
+	return genresLoaded(genres)
+}
+
+// Filters only make sense where the results come from a query
+func (m model) filterable() bool {
+	switch m.tabs[m.activeTab] {
+	case "Search", "Library":
+		return true
+	}
+	return false
+}
+
+func (m model) cycleGenre() (tea.Model, tea.Cmd) {
+	next := slices.Index(m.genres, m.filter.Genre) + 1
+	m.filter.Genre = ""
+	if next < len(m.genres) {
+		m.filter.Genre = m.genres[next]
+	}
+	m.list.ResetSelected()
+	return m, m.fetchActiveTabItems
+}
+
+func (m model) cycleType() (tea.Model, tea.Cmd) {
+	next := (slices.Index(filterTypes, m.filter.Type) + 1) % len(filterTypes)
+	m.filter.Type = filterTypes[next]
+	m.list.ResetSelected()
+	return m, m.fetchActiveTabItems
+}
+
+// Remembered for each tab in the config
+func (m model) toggleUnwatched() (tea.Model, tea.Cmd) {
+	tab := m.tabs[m.activeTab]
+	m.unwatched[tab] = !m.unwatched[tab]
+	var tabs []string
+	for _, name := range m.tabs {
+		if m.unwatched[name] {
+			tabs = append(tabs, name)
+		}
+	}
+	status := "Showing everything"
+	if m.unwatched[tab] {
+		status = "Only showing what wasn't watched"
+	}
+	status = saveSetting(status, map[string]any{"unwatched_only": tabs})
+	m.list.ResetSelected()
+	return m, tea.Batch(m.list.NewStatusMessage(status), m.fetchActiveTabItems)
+}
+
+type librariesLoaded []jellyfin.Item
+
+func (m model) fetchLibraries() tea.Msg {
+	libraries, err := m.client.GetLibraries()
+	if err != nil {
+		return err
+	}
+	return librariesLoaded(libraries)
+}
+
+// Latest goes through every library and then back to all of them
+func (m model) cycleLibrary() (tea.Model, tea.Cmd) {
+	next := slices.IndexFunc(m.libraries, func(l jellyfin.Item) bool { return l.GetId() == m.latestLibrary.GetId() }) + 1
+	m.latestLibrary = jellyfin.Item{}
+	status := "Latest from all libraries"
+	if next < len(m.libraries) {
+		m.latestLibrary = m.libraries[next]
+		status = "Latest from " + m.latestLibrary.GetName()
+	}
+	m.list.ResetSelected()
+	return m, tea.Batch(m.list.NewStatusMessage(status), m.fetchActiveTabItems)
+}
+
+// Orders the sort selector cycles through, empty for the default order of the list
+var sortOptions = []api.ItemSortBy{
+	"",
+	api.ITEMSORTBY_SORT_NAME,
+	api.ITEMSORTBY_DATE_CREATED,
+	api.ITEMSORTBY_COMMUNITY_RATING,
+	api.ITEMSORTBY_PREMIERE_DATE,
+	api.ITEMSORTBY_RANDOM,
+}
+
+func (m model) sortable() bool {
+	switch m.tabs[m.activeTab] {
+	case "Latest", "Library":
+		return true
+	}
+	return false
+}
+
+// The last sort used is remembered in the config
+func (m model) setSort(sort jellyfin.Sort) (tea.Model, tea.Cmd) {
+	m.sort = sort
+	status := saveSetting("Sorted by "+describeSort(sort), map[string]any{"sort_by": string(sort.By), "sort_descending": sort.Descending})
+	m.list.ResetSelected()
+	return m, tea.Batch(m.list.NewStatusMessage(status), m.fetchActiveTabItems)
+}
+
+func describeSort(sort jellyfin.Sort) string {
+	if sort.By == "" {
+		return "default order"
+	}
+	order := "ascending"
+	if sort.Descending {
+		order = "descending"
+	}
+	return fmt.Sprintf("%s, %s", sort.By, order)
+}
+
+// Shown next to the search input or the library path, empty without filters
+func describeFilter(filter jellyfin.Filter) string {
+	var parts []string
+	if filter.Genre != "" {
+		parts = append(parts, filter.Genre)
+	}
+	if filter.Type != "" {
+		parts = append(parts, string(filter.Type)+"s")
+	}
+	if filter.Unwatched {
+		parts = append(parts, "unwatched")
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
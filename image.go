@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/hacel/jfsh/jellyfin"
+	"github.com/sj14/jellyfin-go/api"
+	"github.com/spf13/viper"
+)
+
+// Columns taken by the artwork next to the list
+const imageWidth = 30
+
+type imageLoaded struct {
+	id    string
+	image string // empty if the item has no image or it couldn't be rendered
+}
+
+// chafa turns the image into colored text so it can be drawn like the rest of the view,
+// without it there are no images
+func imagesEnabled() bool {
+	if !viper.GetBool("images") {
+		return false
+	}
+	_, err := exec.LookPath("chafa")
+	return err == nil
+}
+
+func renderImage(url string, width, height int) (string, error) {
+	res, err := jellyfin.HTTPClient(10 * time.Second).Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get image: %s", res.Status)
+	}
+	var out bytes.Buffer
+	cmd := exec.Command("chafa", "--format=symbols", fmt.Sprintf("--size=%dx%d", width, height), "-")
+	cmd.Stdin = res.Body
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(out.String(), "\n"), nil
+}
+
+// Starts loading the artwork of the selected item unless it's already loaded or loading
+func (m model) fetchImage() tea.Cmd {
+	if m.images == nil {
+		return nil
+	}
+	selected, ok := m.list.SelectedItem().(item)
+	if !ok || selected.Id == nil {
+		return nil
+	}
+	id := *selected.Id
+	if _, ok := m.images[id]; ok {
+		return nil
+	}
+	m.images[id] = ""
+	url := m.client.GetImageURL(jellyfin.Item(selected), api.IMAGETYPE_PRIMARY)
+	height := m.list.Height()
+	return func() tea.Msg {
+		image, err := renderImage(url, imageWidth, height)
+		if err != nil {
+			// most likely the item has no image, nothing worth showing an error for
+			return imageLoaded{id: id}
+		}
+		return imageLoaded{id, image}
+	}
+}
+
+// Rendered artwork of the selected item, empty if there is none
+func (m model) selectedImage() string {
+	if selected, ok := m.list.SelectedItem().(item); ok && selected.Id != nil {
+		return m.images[*selected.Id]
+	}
+	return ""
+}
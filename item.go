@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/charmbracelet/lipgloss"
 	"github.com/hacel/jfsh/jellyfin"
 	"github.com/sj14/jellyfin-go/api"
 )
@@ -16,18 +17,92 @@ func (i item) Title() string {
 	switch *i.Type {
 	case api.BASEITEMKIND_MOVIE:
 		fmt.Fprintf(str, "%s (%d)", *i.Name.Get(), *i.ProductionYear.Get())
-		if i.UserData.IsSet() && i.UserData.Get().PlayedPercentage.IsSet() {
-			fmt.Fprintf(str, " [%.f%%]", *i.UserData.Get().PlayedPercentage.Get())
+		if percent, ok := i.progress(); ok {
+			fmt.Fprintf(str, " %s %.f%%", progressBar(percent, 10), percent)
+		}
+		if i.played() {
+			str.WriteString(" ✓")
 		}
 	case api.BASEITEMKIND_EPISODE:
 		fmt.Fprintf(str, "%s S%.2dE%.2d", *i.SeriesName.Get(), *i.ParentIndexNumber.Get(), *i.IndexNumber.Get())
-		if i.UserData.IsSet() && i.UserData.Get().PlayedPercentage.IsSet() {
-			fmt.Fprintf(str, " [%.f%%]", *i.UserData.Get().PlayedPercentage.Get())
+		if percent, ok := i.progress(); ok {
+			fmt.Fprintf(str, " %s %.f%%", progressBar(percent, 10), percent)
+		}
+		if i.played() {
+			str.WriteString(" ✓")
 		}
+	case api.BASEITEMKIND_SERIES:
+		fmt.Fprintf(str, "%s", *i.Name.Get())
+		if i.ProductionYear.IsSet() && i.ProductionYear.Get() != nil {
+			fmt.Fprintf(str, " (%d)", *i.ProductionYear.Get())
+		}
+	default: // libraries, seasons, folders
+		fmt.Fprintf(str, "%s", *i.Name.Get())
+	}
+	if i.favorite() {
+		str.WriteString(" ★")
 	}
 	return str.String()
 }
 
+// Percentage watched of a partly watched item, from the server or computed from the saved position
+func (i item) progress() (percent float64, ok bool) {
+	data := i.userData()
+	if data.PlayedPercentage.Get() != nil {
+		return *data.PlayedPercentage.Get(), true
+	}
+	dto := jellyfin.Item(i)
+	runtime := dto.GetRunTimeTicks()
+	if data.PlaybackPositionTicks == nil || *data.PlaybackPositionTicks == 0 || runtime <= 0 {
+		return 0, false
+	}
+	return float64(*data.PlaybackPositionTicks) / float64(runtime) * 100, true
+}
+
+func progressBar(percent float64, width int) string {
+	filled := min(max(int(percent/100*float64(width)+0.5), 0), width)
+	return strings.Repeat("▰", filled) + strings.Repeat("▱", width-filled)
+}
+
+func (i item) played() bool {
+	return i.UserData.Get() != nil && i.UserData.Get().Played != nil && *i.UserData.Get().Played
+}
+
+func (i item) favorite() bool {
+	return i.UserData.Get() != nil && i.UserData.Get().IsFavorite != nil && *i.UserData.Get().IsFavorite
+}
+
+// Copy of the user data so changing it doesn't touch other copies of the item
+func (i item) userData() api.UserItemDataDto {
+	if i.UserData.Get() != nil {
+		return *i.UserData.Get()
+	}
+	return api.UserItemDataDto{}
+}
+
+func (i item) withFavorite(favorite bool) item {
+	data := i.userData()
+	data.IsFavorite = &favorite
+	i.UserData.Set(&data)
+	return i
+}
+
+// Copy of the item with the played state changed the same way the server does it
+func (i item) withPlayed(played bool) item {
+	data := i.userData()
+	data.Played = &played
+	data.PlayedPercentage = api.NullableFloat64{}
+	var pos int64
+	data.PlaybackPositionTicks = &pos
+	i.UserData.Set(&data)
+	return i
+}
+
+// Folders are browsed into instead of played
+func (i item) isFolder() bool {
+	return i.IsFolder.Get() != nil && *i.IsFolder.Get()
+}
+
 func (i item) Description() string {
 	str := &strings.Builder{}
 	switch *i.Type {
@@ -35,8 +110,46 @@ func (i item) Description() string {
 		fmt.Fprintf(str, "%s", *i.Name.Get())
 	case api.BASEITEMKIND_EPISODE:
 		fmt.Fprintf(str, "%s", *i.Name.Get())
+	default:
+		fmt.Fprintf(str, "%s", *i.Type)
 	}
 	return str.String()
 }
 
 func (i item) FilterValue() string { return *i.Name.Get() }
+
+// Lines reserved under the list for details, including the gap above them
+const detailsHeight = 5
+
+// Overview and facts about the item, wrapped to width and cut to fit in detailsHeight,
+// extra is added to the facts
+func (i item) details(width int, extra string) string {
+	dto := jellyfin.Item(i)
+	var facts []string
+	if dto.GetType() == api.BASEITEMKIND_EPISODE {
+		facts = append(facts, fmt.Sprintf("%s S%dE%d", dto.GetSeriesName(), dto.GetParentIndexNumber(), dto.GetIndexNumber()))
+	}
+	if year := dto.GetProductionYear(); year > 0 {
+		facts = append(facts, fmt.Sprint(year))
+	}
+	if runtime := dto.GetRunTimeTicks() / 10000000; runtime > 0 {
+		facts = append(facts, formatDuration(runtime))
+	}
+	if rating := dto.GetCommunityRating(); rating > 0 {
+		facts = append(facts, fmt.Sprintf("★ %.1f", rating))
+	}
+	if genres := dto.GetGenres(); len(genres) > 0 {
+		facts = append(facts, strings.Join(genres, ", "))
+	}
+	if extra != "" {
+		facts = append(facts, extra)
+	}
+	lines := []string{strings.Join(facts, " • ")}
+	overview := lipgloss.NewStyle().Width(width).Render(dto.GetOverview())
+	lines = append(lines, strings.Split(overview, "\n")...)
+	if len(lines) > detailsHeight-1 {
+		lines = lines[:detailsHeight-1]
+		lines[len(lines)-1] = strings.TrimRight(lines[len(lines)-1], " ") + "…"
+	}
+	return strings.Join(lines, "\n")
+}
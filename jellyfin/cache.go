@@ -0,0 +1,59 @@
+package jellyfin
+
+import (
+	"sync"
+	"time"
+)
+
+// In memory cache of list responses so flipping between views doesn't hit the server every time
+type cache struct {
+	mu      sync.Mutex
+	ttl     time.Duration // 0 turns the cache off
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	items   []Item
+	expires time.Time
+}
+
+func (c *Client) SetCacheTTL(ttl time.Duration) {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	c.cache.ttl = ttl
+}
+
+// Drops everything cached, e.g. after something was changed on the server
+func (c *Client) InvalidateCache() {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	clear(c.cache.entries)
+}
+
+// Drops the lists that change once an episode of the series is watched, the rest stays cached
+func (c *Client) InvalidateSeries(seriesId string) {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	for _, key := range []string{"resume", "nextup", "episodes/" + seriesId, "unplayed/" + seriesId} {
+		delete(c.cache.entries, key)
+	}
+}
+
+// Returns the cached response for key, or calls fetch and caches the result if it succeeds
+func (c *Client) cached(key string, fetch func() ([]Item, error)) ([]Item, error) {
+	c.cache.mu.Lock()
+	entry, ok := c.cache.entries[key]
+	ttl := c.cache.ttl
+	c.cache.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.items, nil
+	}
+	items, err := fetch()
+	if err != nil || ttl <= 0 {
+		return items, err
+	}
+	c.cache.mu.Lock()
+	c.cache.entries[key] = cacheEntry{items, time.Now().Add(ttl)}
+	c.cache.mu.Unlock()
+	return items, nil
+}
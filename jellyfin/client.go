@@ -3,32 +3,77 @@ package jellyfin
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/sj14/jellyfin-go/api"
 )
 
+// Extra fields requested for every list so items carry enough info for playback and the details panel
+var itemFields = []api.ItemFields{
+	api.ITEMFIELDS_MEDIA_SOURCES, api.ITEMFIELDS_CHAPTERS, api.ITEMFIELDS_PROVIDER_IDS,
+	api.ITEMFIELDS_OVERVIEW, api.ITEMFIELDS_GENRES,
+}
+
 type (
 	// Type alias because it looks nicer
 	Item   = api.BaseItemDto
 	Client struct {
-		api                *api.APIClient
-		UserId             string
-		Token              string
-		lastProgressReport time.Time // used for debouncing progress updates
+		api      *api.APIClient
+		host     string
+		deviceId string
+		cache    *cache
+		retries  int // extra attempts for requests that failed with a retryable error
+		limits   Limits
+		timeout  time.Duration
+		ctx      context.Context // parent of every request, canceled by Close
+		cancel   context.CancelFunc
+		auth     auth
+		UserId   string
+		Token    string // changes when the client logs in again, after NewClient use the token method
 	}
 )
 
-// get token and user id
-func authorize(url, username, password, client, device, deviceId, version string) (token, userId string, err error) {
+// Until SetTimeout is called
+const defaultTimeout = 30 * time.Second
+
+// Most items fetched for a list, until SetLimits is called
+type Limits struct {
+	Latest int32
+	Search int32
+}
+
+var defaultLimits = Limits{Latest: 30, Search: 50}
+
+var ErrInvalidToken = errors.New("access token or api key was rejected by the server")
+
+// api client without a token, for logging in
+func anonymousClient(url, client, device, deviceId, version string) *api.APIClient {
 	authHeader := fmt.Sprintf("MediaBrowser Client=%q, Device=%q, DeviceId=%q, Version=%q", client, device, deviceId, version)
 	config := &api.Configuration{
 		Servers:       api.ServerConfigurations{{URL: url}},
 		DefaultHeader: map[string]string{"Authorization": authHeader},
+		UserAgent:     userAgent(client, version),
+		HTTPClient:    httpClient,
 	}
-	cl := api.NewAPIClient(config)
-	res, _, err := cl.UserAPI.AuthenticateUserByName(context.Background()).AuthenticateUserByName(api.AuthenticateUserByName{
+	return api.NewAPIClient(config)
+}
+
+// Proxies and server logs see the same client as the Authorization header
+func userAgent(client, version string) string {
+	return client + "/" + version
+}
+
+// get token and user id
+func authorize(url, username, password, client, device, deviceId, version string) (token, userId string, err error) {
+	cl := anonymousClient(url, client, device, deviceId, version)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	res, _, err := cl.UserAPI.AuthenticateUserByName(ctx).AuthenticateUserByName(api.AuthenticateUserByName{
 		Username: *api.NewNullableString(&username),
 		Pw:       *api.NewNullableString(&password),
 	}).Execute()
@@ -40,8 +85,11 @@ func authorize(url, username, password, client, device, deviceId, version string
 	return
 }
 
+// If token is set the password login is skipped and the token is validated instead,
+// userId is looked up from the token when empty
 func NewClient(url, username, password, client, device, deviceId, version, token, userId string) (*Client, error) {
-	if token == "" || userId == "" {
+	validate := token != ""
+	if !validate {
 		newToken, newUserId, err := authorize(url, username, password, client, device, deviceId, version)
 		if err != nil {
 			return nil, err
@@ -50,64 +98,594 @@ func NewClient(url, username, password, client, device, deviceId, version, token
 		userId = newUserId
 	}
 
-	authHeader := fmt.Sprintf("MediaBrowser Client=%q, Device=%q, DeviceId=%q, Version=%q, Token=%q", client, device, deviceId, version, token)
-	config := &api.Configuration{
-		Servers:       api.ServerConfigurations{{URL: url}},
-		DefaultHeader: map[string]string{"Authorization": authHeader},
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		host:     strings.TrimSuffix(url, "/"),
+		deviceId: deviceId,
+		cache:    &cache{entries: map[string]cacheEntry{}},
+		timeout:  defaultTimeout,
+		limits:   defaultLimits,
+		ctx:      ctx,
+		cancel:   cancel,
+		auth: auth{
+			header: fmt.Sprintf("MediaBrowser Client=%q, Device=%q, DeviceId=%q, Version=%q", client, device, deviceId, version),
+		},
+		UserId: userId,
+		Token:  token,
+	}
+	if password != "" {
+		// api keys and quick connect logins can't be renewed
+		c.auth.login = func() (string, error) {
+			token, _, err := authorize(url, username, password, client, device, deviceId, version)
+			return token, err
+		}
+	}
+	// the token is added to every request by authTransport so a new one applies to requests that are retried
+	c.api = api.NewAPIClient(&api.Configuration{
+		Servers:    api.ServerConfigurations{{URL: url}},
+		UserAgent:  userAgent(client, version),
+		HTTPClient: &http.Client{Transport: authTransport{c}},
+	})
+	if validate {
+		if err := c.validate(); err != nil {
+			return nil, err
+		}
 	}
-	apiClient := api.NewAPIClient(config)
-	return &Client{api: apiClient, UserId: userId, Token: token}, nil
+	return c, nil
+}
+
+// Limit for a single call including its retries, 0 for none
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+// Zero or negative limits keep the defaults
+func (c *Client) SetLimits(limits Limits) {
+	if limits.Latest > 0 {
+		c.limits.Latest = limits.Latest
+	}
+	if limits.Search > 0 {
+		c.limits.Search = limits.Search
+	}
+}
+
+// Cancels every request that's still running, the client can't be used after
+func (c *Client) Close() {
+	c.cancel()
+}
+
+func (c *Client) context() (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(c.ctx)
+	}
+	return context.WithTimeout(c.ctx, c.timeout)
+}
+
+// cheap call to make sure the token works, also fills in the user id if it's missing
+func (c *Client) validate() error {
+	ctx, cancel := c.context()
+	defer cancel()
+	var res *http.Response
+	var err error
+	if c.UserId == "" {
+		var user *api.UserDto
+		user, res, err = c.api.UserAPI.GetCurrentUser(ctx).Execute()
+		if err == nil {
+			c.UserId = *user.Id
+		}
+	} else {
+		_, res, err = c.api.ItemsAPI.GetResumeItems(ctx).UserId(c.UserId).Limit(1).Execute()
+	}
+	if err != nil {
+		if res != nil && (res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden) {
+			return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Media streams of the default media source, these are the ones a player sees in the stream
+func GetMediaStreams(item Item) []api.MediaStream {
+	if len(item.MediaSources) > 0 {
+		return item.MediaSources[0].MediaStreams
+	}
+	return item.MediaStreams
+}
+
+// Subtitle streams muxed into the file, in stream order
+func GetEmbeddedSubtitleStreams(item Item) []api.MediaStream {
+	var streams []api.MediaStream
+	for _, stream := range GetMediaStreams(item) {
+		if stream.GetType() == api.MEDIASTREAMTYPE_SUBTITLE && !stream.GetIsExternal() {
+			streams = append(streams, stream)
+		}
+	}
+	return streams
+}
+
+// Text subtitle streams in files next to the media, players only get these by adding them separately
+func GetExternalSubtitleStreams(item Item) []api.MediaStream {
+	var streams []api.MediaStream
+	for _, stream := range GetMediaStreams(item) {
+		if stream.GetType() == api.MEDIASTREAMTYPE_SUBTITLE && stream.GetIsExternal() && stream.GetIsTextSubtitleStream() {
+			streams = append(streams, stream)
+		}
+	}
+	return streams
+}
+
+// Url of an image of the item, with the token so it can be fetched without headers
+func (c *Client) GetImageURL(item Item, imageType api.ImageType) string {
+	query := url.Values{"api_key": {c.token()}}
+	return fmt.Sprintf("%s/Items/%s/Images/%s?%s", c.host, item.GetId(), imageType, query.Encode())
 }
 
 func (c *Client) GetResume() ([]Item, error) {
-	res, _, err := c.api.ItemsAPI.GetResumeItems(context.Background()).UserId(c.UserId).Execute()
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.cached("resume", func() ([]Item, error) {
+		res, _, err := retry(c, c.api.ItemsAPI.GetResumeItems(ctx).UserId(c.UserId).Fields(itemFields).Execute)
+		if err != nil {
+			return nil, err
+		}
+		return res.Items, nil
+	})
+}
+
+func (c *Client) GetNextUp() ([]Item, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.cached("nextup", func() ([]Item, error) {
+		res, _, err := retry(c, c.api.TvShowsAPI.GetNextUp(ctx).Fields(itemFields).Execute)
+		if err != nil {
+			return nil, err
+		}
+		return res.Items, nil
+	})
+}
+
+// Recently added movies and episodes, only from the library with libraryId unless it's empty. unwatched leaves out what was played
+func (c *Client) GetLatest(libraryId string, sort Sort, unwatched bool) ([]Item, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	if sort.By == "" {
+		// newest first by default, reversing the default order gives oldest first
+		sort = Sort{By: api.ITEMSORTBY_DATE_CREATED, Descending: !sort.Descending}
+	}
+	return c.cached(fmt.Sprintf("latest/%s/%t/%s", libraryId, unwatched, sort.key()), func() ([]Item, error) {
+		req := c.api.ItemsAPI.GetItems(ctx).
+			Recursive(true).
+			SortBy([]api.ItemSortBy{sort.By, api.ITEMSORTBY_NAME}).
+			IncludeItemTypes([]api.BaseItemKind{api.BASEITEMKIND_MOVIE, api.BASEITEMKIND_EPISODE}).
+			Limit(c.limits.Latest).
+			SortOrder([]api.SortOrder{sort.order()}).
+			Fields(itemFields)
+		if libraryId != "" {
+			req = req.ParentId(libraryId)
+		}
+		if unwatched {
+			req = req.IsPlayed(false)
+		}
+		res, _, err := retry(c, req.Execute)
+		if err != nil {
+			return nil, err
+		}
+		return res.Items, nil
+	})
+}
+
+// Narrows down search and browse results, the zero value doesn't filter anything
+type Filter struct {
+	Genre     string
+	Type      api.BaseItemKind // empty for any type
+	Unwatched bool             // leave out what was played, a series counts as played once every episode is
+}
+
+// The unwatched filter also works on folders, the others only make sense on everything under the parent
+func (f Filter) active() bool {
+	return f.Genre != "" || f.Type != ""
+}
+
+// Order of a list, the zero value keeps the default order of each list
+type Sort struct {
+	By         api.ItemSortBy
+	Descending bool
+}
+
+func (s Sort) order() api.SortOrder {
+	if s.Descending {
+		return api.SORTORDER_DESCENDING
+	}
+	return api.SORTORDER_ASCENDING
+}
+
+func (s Sort) key() string {
+	return fmt.Sprintf("%s/%s", s.By, s.order())
+}
+
+func (c *Client) Search(query string, filter Filter) ([]Item, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	types := []api.BaseItemKind{api.BASEITEMKIND_MOVIE, api.BASEITEMKIND_EPISODE}
+	if filter.Type != "" {
+		types = []api.BaseItemKind{filter.Type}
+	}
+	req := c.api.ItemsAPI.GetItems(ctx).
+		SearchTerm(query).
+		Recursive(true).
+		IncludeItemTypes(types).
+		Limit(c.limits.Search).
+		Fields(itemFields)
+	if filter.Genre != "" {
+		req = req.Genres([]string{filter.Genre})
+	}
+	if filter.Unwatched {
+		req = req.IsPlayed(false)
+	}
+	res, _, err := retry(c, req.Execute)
 	if err != nil {
 		return nil, err
 	}
 	return res.Items, nil
 }
 
-func (c *Client) GetNextUp() ([]Item, error) {
-	res, _, err := c.api.TvShowsAPI.GetNextUp(context.Background()).Execute()
+// Top level libraries (Movies, Shows, ...) of the user
+func (c *Client) GetLibraries() ([]Item, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.cached("libraries", func() ([]Item, error) {
+		res, _, err := retry(c, c.api.UserViewsAPI.GetUserViews(ctx).UserId(c.UserId).Execute)
+		if err != nil {
+			return nil, err
+		}
+		return res.Items, nil
+	})
+}
+
+// Direct children of a library or folder, e.g. the seasons of a series or the episodes of a season.
+// With a filter everything under the parent that matches it is returned instead
+func (c *Client) GetChildren(parent Item, filter Filter, sort Sort) ([]Item, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	key := fmt.Sprintf("children/%s/%s/%s/%t/%s", parent.GetId(), filter.Genre, filter.Type, filter.Unwatched, sort.key())
+	return c.cached(key, func() ([]Item, error) {
+		sortBy := []api.ItemSortBy{api.ITEMSORTBY_PARENT_INDEX_NUMBER, api.ITEMSORTBY_INDEX_NUMBER, api.ITEMSORTBY_SORT_NAME}
+		if sort.By != "" {
+			sortBy = []api.ItemSortBy{sort.By, api.ITEMSORTBY_SORT_NAME}
+		}
+		req := c.api.ItemsAPI.GetItems(ctx).
+			UserId(c.UserId).
+			ParentId(parent.GetId()).
+			SortBy(sortBy).
+			SortOrder([]api.SortOrder{sort.order()}).
+			Fields(itemFields)
+		if filter.active() {
+			req = req.Recursive(true)
+		}
+		if filter.Genre != "" {
+			req = req.Genres([]string{filter.Genre})
+		}
+		if filter.Type != "" {
+			req = req.IncludeItemTypes([]api.BaseItemKind{filter.Type})
+		}
+		if filter.Unwatched {
+			req = req.IsPlayed(false)
+		}
+		res, _, err := retry(c, req.Execute)
+		if err != nil {
+			return nil, err
+		}
+		return res.Items, nil
+	})
+}
+
+// Names of all genres in the user's libraries
+func (c *Client) GetGenres() ([]string, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	res, _, err := retry(c, c.api.GenresAPI.GetGenres(ctx).UserId(c.UserId).SortBy([]api.ItemSortBy{api.ITEMSORTBY_SORT_NAME}).Execute)
 	if err != nil {
 		return nil, err
 	}
-	return res.Items, nil
+	var genres []string
+	for _, genre := range res.Items {
+		genres = append(genres, genre.GetName())
+	}
+	return genres, nil
+}
+
+// All episodes of the series the episode belongs to, in order
+func (c *Client) GetEpisodes(episode Item) ([]Item, error) {
+	return c.GetSeriesEpisodes(episode.GetSeriesId())
+}
+
+// All episodes of a series in order, cached per series
+func (c *Client) GetSeriesEpisodes(seriesId string) ([]Item, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.cached("episodes/"+seriesId, func() ([]Item, error) {
+		res, _, err := retry(c, c.api.TvShowsAPI.GetEpisodes(ctx, seriesId).
+			UserId(c.UserId).
+			Fields(itemFields).
+			Execute)
+		if err != nil {
+			return nil, err
+		}
+		return res.Items, nil
+	})
+}
+
+func (c *Client) GetSeasons(series Item) ([]Item, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.cached("seasons/"+series.GetId(), func() ([]Item, error) {
+		res, _, err := retry(c, c.api.TvShowsAPI.GetSeasons(ctx, series.GetId()).
+			UserId(c.UserId).
+			Fields(itemFields).
+			Execute)
+		if err != nil {
+			return nil, err
+		}
+		return res.Items, nil
+	})
+}
+
+func (c *Client) GetItem(id string) (Item, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	res, _, err := retry(c, c.api.UserLibraryAPI.GetItem(ctx, id).UserId(c.UserId).Execute)
+	if err != nil {
+		return Item{}, err
+	}
+	return *res, nil
 }
 
-func (c *Client) GetLatest() ([]Item, error) {
-	res, _, err := c.api.ItemsAPI.GetItems(context.Background()).
+// Runtime left of the unwatched and partly watched episodes of a series, in seconds
+func (c *Client) GetRemainingRuntime(seriesId string) (secs int64, episodes int, err error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	items, err := c.cached("unplayed/"+seriesId, func() ([]Item, error) {
+		res, _, err := retry(c, c.api.ItemsAPI.GetItems(ctx).
+			UserId(c.UserId).
+			ParentId(seriesId).
+			Recursive(true).
+			IncludeItemTypes([]api.BaseItemKind{api.BASEITEMKIND_EPISODE}).
+			IsPlayed(false).
+			Execute)
+		if err != nil {
+			return nil, err
+		}
+		return res.Items, nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	var ticks int64
+	for _, item := range items {
+		ticks += item.GetRunTimeTicks()
+		if data := item.UserData.Get(); data != nil && data.PlaybackPositionTicks != nil {
+			ticks -= *data.PlaybackPositionTicks
+		}
+	}
+	return ticks / 10000000, len(items), nil
+}
+
+func (c *Client) GetFavorites() ([]Item, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.cached("favorites", func() ([]Item, error) {
+		res, _, err := retry(c, c.api.ItemsAPI.GetItems(ctx).
+			UserId(c.UserId).
+			IsFavorite(true).
+			Recursive(true).
+			IncludeItemTypes([]api.BaseItemKind{api.BASEITEMKIND_MOVIE, api.BASEITEMKIND_SERIES, api.BASEITEMKIND_EPISODE}).
+			SortBy([]api.ItemSortBy{api.ITEMSORTBY_SORT_NAME}).
+			Fields(itemFields).
+			Execute)
+		if err != nil {
+			return nil, err
+		}
+		return res.Items, nil
+	})
+}
+
+// Collections (box sets) of the user, their items are the children of the collection
+func (c *Client) GetCollections() ([]Item, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.cached("collections", func() ([]Item, error) {
+		res, _, err := retry(c, c.api.ItemsAPI.GetItems(ctx).
+			UserId(c.UserId).
+			Recursive(true).
+			IncludeItemTypes([]api.BaseItemKind{api.BASEITEMKIND_BOX_SET}).
+			SortBy([]api.ItemSortBy{api.ITEMSORTBY_SORT_NAME}).
+			Fields(itemFields).
+			Execute)
+		if err != nil {
+			return nil, err
+		}
+		return res.Items, nil
+	})
+}
+
+// Playlists of the user
+func (c *Client) GetPlaylists() ([]Item, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.cached("playlists", func() ([]Item, error) {
+		res, _, err := retry(c, c.api.ItemsAPI.GetItems(ctx).
+			UserId(c.UserId).
+			Recursive(true).
+			IncludeItemTypes([]api.BaseItemKind{api.BASEITEMKIND_PLAYLIST}).
+			SortBy([]api.ItemSortBy{api.ITEMSORTBY_SORT_NAME}).
+			Fields(itemFields).
+			Execute)
+		if err != nil {
+			return nil, err
+		}
+		return res.Items, nil
+	})
+}
+
+// Items of a playlist in the playlist's order
+func (c *Client) GetPlaylistItems(id string) ([]Item, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.cached("playlist/"+id, func() ([]Item, error) {
+		res, _, err := retry(c, c.api.PlaylistsAPI.GetPlaylistItems(ctx, id).
+			UserId(c.UserId).
+			Fields(itemFields).
+			Execute)
+		if err != nil {
+			return nil, err
+		}
+		return res.Items, nil
+	})
+}
+
+// A random unwatched movie or episode from anywhere under parent, ok is false if everything was watched
+func (c *Client) GetRandomUnplayed(parent Item) (item Item, ok bool, err error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	res, _, err := retry(c, c.api.ItemsAPI.GetItems(ctx).
+		UserId(c.UserId).
+		ParentId(parent.GetId()).
 		Recursive(true).
-		SortBy([]api.ItemSortBy{api.ITEMSORTBY_DATE_CREATED, api.ITEMSORTBY_NAME}).
 		IncludeItemTypes([]api.BaseItemKind{api.BASEITEMKIND_MOVIE, api.BASEITEMKIND_EPISODE}).
-		Limit(30).
-		SortOrder([]api.SortOrder{api.SORTORDER_DESCENDING}).
-		Execute()
+		IsPlayed(false).
+		SortBy([]api.ItemSortBy{api.ITEMSORTBY_RANDOM}).
+		Limit(1).
+		Fields(itemFields).
+		Execute)
+	if err != nil || len(res.Items) == 0 {
+		return Item{}, false, err
+	}
+	return res.Items[0], true, nil
+}
+
+// Recommendations the server picks from the genres, tags and people of the item, not cached
+// because they're only used to queue them once
+func (c *Client) GetSimilar(item Item) ([]Item, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	res, _, err := retry(c, c.api.LibraryAPI.GetSimilarItems(ctx, item.GetId()).
+		UserId(c.UserId).
+		Limit(similarLimit).
+		Fields(itemFields).
+		Execute)
 	if err != nil {
 		return nil, err
 	}
 	return res.Items, nil
 }
 
-func (c *Client) ReportPlaybackStopped(item Item, pos int64) {
-	posTicks := pos * 10000000
-	if _, err := c.api.PlaystateAPI.ReportPlaybackStopped(context.Background()).PlaybackStopInfo(api.PlaybackStopInfo{
+// Enough for an evening
+const similarLimit = 20
+
+// Trailers followed by the other special features of a movie or series
+func (c *Client) GetExtras(item Item) ([]Item, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.cached("extras/"+item.GetId(), func() ([]Item, error) {
+		trailers, _, err := retry(c, c.api.UserLibraryAPI.GetLocalTrailers(ctx, item.GetId()).UserId(c.UserId).Execute)
+		if err != nil {
+			return nil, err
+		}
+		features, _, err := retry(c, c.api.UserLibraryAPI.GetSpecialFeatures(ctx, item.GetId()).UserId(c.UserId).Execute)
+		if err != nil {
+			return nil, err
+		}
+		return append(trailers, features...), nil
+	})
+}
+
+func (c *Client) SetFavorite(item Item, favorite bool) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	var err error
+	if favorite {
+		_, _, err = c.api.UserLibraryAPI.MarkFavoriteItem(ctx, item.GetId()).UserId(c.UserId).Execute()
+	} else {
+		_, _, err = c.api.UserLibraryAPI.UnmarkFavoriteItem(ctx, item.GetId()).UserId(c.UserId).Execute()
+	}
+	return err
+}
+
+func (c *Client) MarkPlayed(item Item) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, _, err := c.api.PlaystateAPI.MarkPlayedItem(ctx, item.GetId()).UserId(c.UserId).Execute()
+	return err
+}
+
+func (c *Client) MarkUnplayed(item Item) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, _, err := c.api.PlaystateAPI.MarkUnplayedItem(ctx, item.GetId()).UserId(c.UserId).Execute()
+	return err
+}
+
+func (c *Client) ReportPlaybackStart(item Item, state PlayState) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	posTicks := state.Position * 10000000
+	_, err := retryNoBody(c, c.api.PlaystateAPI.ReportPlaybackStart(ctx).PlaybackStartInfo(api.PlaybackStartInfo{
 		ItemId:        item.Id,
 		PositionTicks: *api.NewNullableInt64(&posTicks),
-	}).Execute(); err != nil {
-		panic(err)
-	}
+		PlaySessionId: state.playSessionId(),
+	}).Execute)
+	return err
 }
 
-func (c *Client) ReportPlaybackProgress(item Item, pos int64) {
-	if time.Since(c.lastProgressReport) < time.Second*3 { // debounce
-		return
+func (c *Client) ReportPlaybackStopped(item Item, state PlayState) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	posTicks := state.Position * 10000000
+	_, err := retryNoBody(c, c.api.PlaystateAPI.ReportPlaybackStopped(ctx).PlaybackStopInfo(api.PlaybackStopInfo{
+		ItemId:        item.Id,
+		PositionTicks: *api.NewNullableInt64(&posTicks),
+		PlaySessionId: state.playSessionId(),
+	}).Execute)
+	return err
+}
+
+// Playback state sent along with every progress report, the server replaces
+// its copy of the session state with whatever is in the latest report
+type PlayState struct {
+	Position         int64 // seconds
+	Paused           bool
+	AudioStreamIndex *int32 // jellyfin media stream index, nil if unknown
+	// jellyfin media stream index, -1 when subtitles are off, nil if unknown
+	SubtitleStreamIndex *int32
+	// ties the reports together so the server sees one session instead of one per report, empty for none
+	PlaySessionId string
+}
+
+func (s PlayState) playSessionId() api.NullableString {
+	if s.PlaySessionId == "" {
+		return api.NullableString{}
 	}
-	posTicks := pos * 10000000
-	if _, err := c.api.PlaystateAPI.ReportPlaybackProgress(context.Background()).PlaybackProgressInfo(api.PlaybackProgressInfo{
+	return *api.NewNullableString(&s.PlaySessionId)
+}
+
+// Not debounced, the caller decides how often to report
+func (c *Client) ReportPlaybackProgress(item Item, state PlayState) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	posTicks := state.Position * 10000000
+	info := api.PlaybackProgressInfo{
 		ItemId:        item.Id,
 		PositionTicks: *api.NewNullableInt64(&posTicks),
-	}).Execute(); err != nil {
-		panic(err)
+		IsPaused:      &state.Paused,
+		PlaySessionId: state.playSessionId(),
+	}
+	if state.AudioStreamIndex != nil {
+		info.AudioStreamIndex = *api.NewNullableInt32(state.AudioStreamIndex)
+	}
+	if state.SubtitleStreamIndex != nil {
+		info.SubtitleStreamIndex = *api.NewNullableInt32(state.SubtitleStreamIndex)
 	}
+	_, err := retryNoBody(c, c.api.PlaystateAPI.ReportPlaybackProgress(ctx).PlaybackProgressInfo(info).Execute)
+	return err
 }
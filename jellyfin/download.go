@@ -0,0 +1,89 @@
+package jellyfin
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/sj14/jellyfin-go/api"
+)
+
+// Bytes written so far out of the total, updated while a download runs
+type DownloadProgress struct {
+	done, total atomic.Int64
+}
+
+// 0 to 100, 0 while the size isn't known
+func (p *DownloadProgress) Percent() float64 {
+	total := p.total.Load()
+	if total <= 0 {
+		return 0
+	}
+	return float64(p.done.Load()) / float64(total) * 100
+}
+
+func (p *DownloadProgress) Write(b []byte) (int, error) {
+	p.done.Add(int64(len(b)))
+	return len(b), nil
+}
+
+// File name for an item, readable and unique because of the id
+func downloadName(item Item) string {
+	name := item.GetName()
+	if item.GetType() == api.BASEITEMKIND_EPISODE {
+		name = fmt.Sprintf("%s S%.2dE%.2d %s", item.GetSeriesName(), item.GetParentIndexNumber(), item.GetIndexNumber(), name)
+	}
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	ext := filepath.Ext(item.GetPath())
+	if ext == "" && len(item.MediaSources) > 0 {
+		ext = "." + strings.Split(item.MediaSources[0].GetContainer(), ",")[0]
+	}
+	return fmt.Sprintf("%s [%s]%s", name, item.GetId(), ext)
+}
+
+// Saves the original file of the item in dir and returns its path, the file only gets its name once it's complete.
+// Downloads aren't limited by the api timeout, Close cancels them
+func (c *Client) DownloadItem(item Item, dir string, progress *DownloadProgress) (string, error) {
+	query := url.Values{"api_key": {c.token()}}
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, fmt.Sprintf("%s/Items/%s/Download?%s", c.host, item.GetId(), query.Encode()), nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		// forbidden if the user isn't allowed to download
+		return "", fmt.Errorf("failed to download: %s", res.Status)
+	}
+	progress.total.Store(res.ContentLength)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, downloadName(item))
+	f, err := os.Create(path + ".part")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(io.MultiWriter(f, progress), res.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".part")
+		return "", err
+	}
+	return path, os.Rename(path+".part", path)
+}
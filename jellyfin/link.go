@@ -0,0 +1,47 @@
+package jellyfin
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Item ids are guids, the server writes them without dashes but takes them either way
+var itemId = regexp.MustCompile(`^(?i:[0-9a-f]{32}|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})$`)
+
+// Id of the item a link points to. Takes a plain id, a web UI link like https://host/web/#/details?id=...,
+// an api url like https://host/Items/<id> or https://host/Videos/<id>/stream, and jellyfin://items/<id>.
+// The server isn't asked, the item might not exist
+func ParseItemLink(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if itemId.MatchString(s) {
+		return s, true
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" {
+		return "", false
+	}
+	// the web UI routes in the fragment, older versions with #!
+	if fragment, err := url.Parse(strings.TrimPrefix(u.Fragment, "!")); err == nil && u.Fragment != "" {
+		if id := fragment.Query().Get("id"); itemId.MatchString(id) {
+			return id, true
+		}
+	}
+	if id := u.Query().Get("id"); itemId.MatchString(id) {
+		return id, true
+	}
+	// jellyfin://items/<id> has items as the host
+	path := strings.Split(strings.Trim(u.Host+u.Path, "/"), "/")
+	if u.Scheme != "jellyfin" {
+		path = strings.Split(strings.Trim(u.Path, "/"), "/")
+	}
+	for i := 0; i+1 < len(path); i++ {
+		switch strings.ToLower(path[i]) {
+		case "items", "item", "videos", "audio":
+			if itemId.MatchString(path[i+1]) {
+				return path[i+1], true
+			}
+		}
+	}
+	return "", false
+}
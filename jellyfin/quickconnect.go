@@ -0,0 +1,52 @@
+package jellyfin
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sj14/jellyfin-go/api"
+)
+
+var ErrQuickConnectDisabled = errors.New("quick connect is disabled on the server")
+
+// Pending Quick Connect login, the user approves Code in the web ui of the server
+type QuickConnect struct {
+	api    *api.APIClient
+	Code   string
+	secret string
+}
+
+// The device has to stay the same until the login is approved, the token is issued to it
+func InitiateQuickConnect(url, client, device, deviceId, version string) (*QuickConnect, error) {
+	cl := anonymousClient(url, client, device, deviceId, version)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	enabled, _, err := cl.QuickConnectAPI.GetQuickConnectEnabled(ctx).Execute()
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrQuickConnectDisabled
+	}
+	res, _, err := cl.QuickConnectAPI.InitiateQuickConnect(ctx).Execute()
+	if err != nil {
+		return nil, err
+	}
+	return &QuickConnect{api: cl, Code: res.GetCode(), secret: res.GetSecret()}, nil
+}
+
+// ok is false until the login was approved, after that token and userId can be passed to NewClient
+func (q *QuickConnect) Check() (token, userId string, ok bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	state, _, err := q.api.QuickConnectAPI.GetQuickConnectState(ctx).Secret(q.secret).Execute()
+	if err != nil || !state.GetAuthenticated() {
+		return "", "", false, err
+	}
+	res, _, err := q.api.UserAPI.AuthenticateWithQuickConnect(ctx).QuickConnectDto(api.QuickConnectDto{Secret: q.secret}).Execute()
+	if err != nil {
+		return "", "", false, err
+	}
+	user := res.GetUser()
+	return res.GetAccessToken(), user.GetId(), true, nil
+}
@@ -0,0 +1,56 @@
+package jellyfin
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// Login state shared by every request of a client
+type auth struct {
+	mu     sync.Mutex
+	header string                 // Authorization header without the token
+	login  func() (string, error) // gets a new token, nil if the client can't log in by itself
+}
+
+func (c *Client) token() string {
+	c.auth.mu.Lock()
+	defer c.auth.mu.Unlock()
+	return c.Token
+}
+
+// Adds the current token to every api request
+type authTransport struct{ c *Client }
+
+func (t authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", fmt.Sprintf("%s, Token=%q", t.c.auth.header, t.c.token()))
+	transport := httpClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return transport.RoundTrip(req)
+}
+
+// Logs in again after the server rejected the token a request was sent with, e.g. because the session was
+// removed while the server restarted. Returns whether there's a new token to try, another request might
+// have renewed it already
+func (c *Client) reauthorize(rejected string) bool {
+	c.auth.mu.Lock()
+	defer c.auth.mu.Unlock()
+	if c.Token != rejected {
+		return true
+	}
+	if c.auth.login == nil {
+		return false
+	}
+	token, err := c.auth.login()
+	if err != nil {
+		slog.Error("failed to log in again after the token was rejected", "err", err)
+		return false
+	}
+	c.Token = token
+	slog.Info("logged in again after the token was rejected")
+	return true
+}
@@ -0,0 +1,16 @@
+package jellyfin
+
+import "regexp"
+
+var (
+	// tokens in query strings and auth headers, passwords in login bodies
+	secrets = regexp.MustCompile(`(?i)((?:api_key|apikey|access_token|token|password|pw)=|Token="|Bearer |"(?:Pw|Password|AccessToken)":\s*")[^&"\s]+`)
+	// passwords in proxy urls
+	userinfo = regexp.MustCompile(`(://[^/:@\s]+:)[^/@\s]+@`)
+)
+
+// Masks tokens and passwords, for anything that's logged or shown and might end up in an issue
+func Redact(s string) string {
+	s = secrets.ReplaceAllString(s, "${1}REDACTED")
+	return userinfo.ReplaceAllString(s, "${1}REDACTED@")
+}
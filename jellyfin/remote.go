@@ -0,0 +1,107 @@
+package jellyfin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/sj14/jellyfin-go/api"
+)
+
+// Playstate command from another client controlling this session, e.g. the web UI
+type RemoteCommand struct {
+	Command           string // Pause, Unpause, PlayPause, Stop, Seek, NextTrack or PreviousTrack
+	SeekPositionTicks int64
+}
+
+// Session socket the server sends remote control commands over
+type Remote struct {
+	ws   *websocket
+	done chan struct{} // closed once the socket stopped being read
+}
+
+type socketMessage struct {
+	MessageType string
+	Data        json.RawMessage `json:",omitempty"`
+}
+
+// Makes the session controllable from other clients and calls handle with every playstate command,
+// from another goroutine, until Close
+func (c *Client) ListenRemote(handle func(RemoteCommand)) (*Remote, error) {
+	var capabilities api.ClientCapabilitiesDto
+	capabilities.SetPlayableMediaTypes([]api.MediaType{api.MEDIATYPE_VIDEO, api.MEDIATYPE_AUDIO})
+	capabilities.SetSupportsMediaControl(true)
+	ctx, cancel := c.context()
+	defer cancel()
+	if _, err := retryNoBody(c, c.api.SessionAPI.PostFullCapabilities(ctx).ClientCapabilitiesDto(capabilities).Execute); err != nil {
+		return nil, err
+	}
+	query := url.Values{"api_key": {c.token()}, "deviceId": {c.deviceId}}
+	ws, err := dialWebsocket(c.host + "/socket?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	r := &Remote{ws: ws, done: make(chan struct{})}
+	go r.listen(handle)
+	return r, nil
+}
+
+func (r *Remote) listen(handle func(RemoteCommand)) {
+	defer close(r.done)
+	keepingAlive := false
+	for {
+		data, err := r.ws.read()
+		if err != nil {
+			slog.Debug("remote control socket closed", "err", err)
+			return
+		}
+		var msg socketMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			slog.Debug("unexpected message on the remote control socket", "err", err)
+			continue
+		}
+		switch msg.MessageType {
+		case "ForceKeepAlive":
+			// the server drops the session if it doesn't hear from it within this many seconds
+			var timeout int
+			if err := json.Unmarshal(msg.Data, &timeout); err != nil || timeout <= 0 || keepingAlive {
+				continue
+			}
+			keepingAlive = true
+			go r.keepAlive(time.Duration(timeout) * time.Second / 2)
+		case "Playstate":
+			var cmd RemoteCommand
+			if err := json.Unmarshal(msg.Data, &cmd); err != nil {
+				slog.Debug("unexpected playstate command", "err", err)
+				continue
+			}
+			handle(cmd)
+		}
+	}
+}
+
+func (r *Remote) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	message, _ := json.Marshal(socketMessage{MessageType: "KeepAlive"})
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			if err := r.ws.writeText(message); err != nil {
+				slog.Debug("failed to keep the remote control socket alive", "err", err)
+			}
+		}
+	}
+}
+
+// Stops listening and waits for a command that's being handled, safe to call on nil
+func (r *Remote) Close() {
+	if r == nil {
+		return
+	}
+	r.ws.Close()
+	<-r.done
+}
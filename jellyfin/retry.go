@@ -0,0 +1,56 @@
+package jellyfin
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+func (c *Client) SetRetries(retries int) {
+	c.retries = max(retries, 0)
+}
+
+// Network errors, rate limits and server errors might go away on their own, anything else won't.
+// A canceled or timed out request would fail the same way again
+func retryable(res *http.Response, err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return res == nil || res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+}
+
+func backoff(attempt int) time.Duration {
+	return 500 * time.Millisecond << attempt
+}
+
+// Calls execute up to c.retries more times with exponential backoff while it fails with a retryable error,
+// only meant for requests that are safe to repeat. A rejected token is renewed once if the client can log in
+func retry[T any](c *Client, execute func() (T, *http.Response, error)) (T, *http.Response, error) {
+	token := c.token()
+	v, res, err := execute()
+	for attempt := 0; attempt < c.retries && retryable(res, err); attempt++ {
+		slog.Debug("retrying request", "attempt", attempt+1, "err", err)
+		select {
+		case <-time.After(backoff(attempt)):
+		case <-c.ctx.Done():
+			// Close was called
+			return v, res, err
+		}
+		v, res, err = execute()
+	}
+	if res != nil && res.StatusCode == http.StatusUnauthorized && c.reauthorize(token) {
+		v, res, err = execute()
+	}
+	return v, res, err
+}
+
+// retry for requests without a response body
+func retryNoBody(c *Client, execute func() (*http.Response, error)) (*http.Response, error) {
+	_, res, err := retry(c, func() (struct{}, *http.Response, error) {
+		res, err := execute()
+		return struct{}{}, res, err
+	})
+	return res, err
+}
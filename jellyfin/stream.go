@@ -0,0 +1,108 @@
+package jellyfin
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+
+	"github.com/sj14/jellyfin-go/api"
+)
+
+var ErrNoMediaSource = errors.New("item has no playable media source")
+
+// mpv plays pretty much anything so direct play is advertised for every container,
+// the transcoding profile is only used when the server refuses that or maxBitrate is set
+func deviceProfile(maxBitrate int32) api.DeviceProfile {
+	var directVideo, directAudio api.DirectPlayProfile
+	directVideo.SetType(api.DLNAPROFILETYPE_VIDEO)
+	directAudio.SetType(api.DLNAPROFILETYPE_AUDIO)
+
+	var transcode api.TranscodingProfile
+	transcode.SetType(api.DLNAPROFILETYPE_VIDEO)
+	transcode.SetContainer("mkv")
+	transcode.SetVideoCodec("h264,hevc")
+	transcode.SetAudioCodec("aac,ac3,eac3,mp3,opus,flac")
+
+	var subtitles []api.SubtitleProfile
+	for _, format := range []string{"ass", "ssa", "srt", "subrip", "vtt", "pgssub", "dvdsub", "dvbsub"} {
+		var p api.SubtitleProfile
+		p.SetFormat(format)
+		p.SetMethod(api.SUBTITLEDELIVERYMETHOD_EMBED)
+		subtitles = append(subtitles, p)
+	}
+
+	var profile api.DeviceProfile
+	profile.SetName("mpv")
+	profile.SetDirectPlayProfiles([]api.DirectPlayProfile{directVideo, directAudio})
+	profile.SetTranscodingProfiles([]api.TranscodingProfile{transcode})
+	profile.SetSubtitleProfiles(subtitles)
+	if maxBitrate > 0 {
+		profile.SetMaxStreamingBitrate(maxBitrate)
+	}
+	return profile
+}
+
+type StreamOptions struct {
+	ForceTranscode bool
+	MaxBitrate     int32 // bits per second, 0 for no limit. Setting it always transcodes
+}
+
+// Negotiates playback with the server and returns the url of the stream,
+// a direct stream if the server allows it, otherwise a transcode
+func (c *Client) GetStreamingURL(item Item, options StreamOptions) (string, error) {
+	transcode := options.ForceTranscode || options.MaxBitrate > 0
+	var info api.PlaybackInfoDto
+	info.SetUserId(c.UserId)
+	info.SetDeviceProfile(deviceProfile(options.MaxBitrate))
+	info.SetEnableDirectPlay(!transcode)
+	info.SetEnableDirectStream(!transcode)
+	info.SetEnableTranscoding(true)
+	if options.MaxBitrate > 0 {
+		info.SetMaxStreamingBitrate(options.MaxBitrate)
+	}
+	// the first version of the item, see WithVersion
+	var sourceId string
+	if len(item.MediaSources) > 0 {
+		sourceId = item.MediaSources[0].GetId()
+		info.SetMediaSourceId(sourceId)
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	res, _, err := retry(c, c.api.MediaInfoAPI.GetPostedPlaybackInfo(ctx, item.GetId()).PlaybackInfoDto(info).Execute)
+	if err != nil {
+		return "", err
+	}
+	sources := res.GetMediaSources()
+	if len(sources) == 0 {
+		return "", ErrNoMediaSource
+	}
+	n := max(slices.IndexFunc(sources, func(s api.MediaSourceInfo) bool { return s.GetId() == sourceId }), 0)
+	source := sources[n]
+	if !transcode && (source.GetSupportsDirectPlay() || source.GetSupportsDirectStream()) {
+		query := url.Values{
+			"static":        {"true"},
+			"mediaSourceId": {source.GetId()},
+			"api_key":       {c.token()},
+		}
+		return fmt.Sprintf("%s/Videos/%s/stream?%s", c.host, item.GetId(), query.Encode()), nil
+	}
+	if source.GetTranscodingUrl() != "" {
+		return c.host + source.GetTranscodingUrl(), nil
+	}
+	return "", ErrNoMediaSource
+}
+
+// Url of an external subtitle stream, served in its own format
+func (c *Client) GetSubtitleURL(item Item, stream api.MediaStream) string {
+	source := item.GetId()
+	if len(item.MediaSources) > 0 {
+		source = item.MediaSources[0].GetId()
+	}
+	format := stream.GetCodec()
+	if format == "subrip" || format == "" {
+		format = "srt"
+	}
+	query := url.Values{"api_key": {c.token()}}
+	return fmt.Sprintf("%s/Videos/%s/%s/Subtitles/%d/Stream.%s?%s", c.host, item.GetId(), source, stream.GetIndex(), format, query.Encode())
+}
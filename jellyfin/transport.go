@@ -0,0 +1,118 @@
+package jellyfin
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Shared by every client, proxies come from HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+var (
+	tlsConfig  = &tls.Config{}
+	httpClient = http.DefaultClient
+)
+
+// Trusts caCert on top of the system certificates, or any certificate with insecureSkipVerify.
+// Has to be called before NewClient to apply to it
+func ConfigureTLS(insecureSkipVerify bool, caCert string) error {
+	config := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if caCert != "" {
+		data, err := os.ReadFile(caCert)
+		if err != nil {
+			return err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in %s", caCert)
+		}
+		config.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	tlsConfig = config
+	httpClient = &http.Client{Transport: transport}
+	return nil
+}
+
+// For requests outside the api like images, with the same proxy and certificates
+func HTTPClient(timeout time.Duration) *http.Client {
+	client := *httpClient
+	client.Timeout = timeout
+	return &client
+}
+
+// Connection to the host of u, tunneled through the proxy for it if there is one
+func dial(u *url.URL) (net.Conn, error) {
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), map[string]string{"http": "80", "https": "443"}[u.Scheme])
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	proxy, err := http.ProxyFromEnvironment(&http.Request{URL: u})
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	if proxy == nil {
+		conn, err = dialer.Dial("tcp", addr)
+	} else {
+		conn, err = dialProxy(dialer, proxy, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "https" {
+		config := tlsConfig.Clone()
+		config.ServerName = u.Hostname()
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	return conn, nil
+}
+
+func dialProxy(dialer *net.Dialer, proxy *url.URL, addr string) (net.Conn, error) {
+	proxyAddr := proxy.Host
+	if proxy.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxy.Hostname(), "80")
+	}
+	conn, err := dialer.Dial("tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	req := &http.Request{Method: http.MethodConnect, URL: &url.URL{Opaque: addr}, Host: addr, Header: http.Header{}}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		req.SetBasicAuth(proxy.User.Username(), password)
+		req.Header.Set("Proxy-Authorization", req.Header.Get("Authorization"))
+		req.Header.Del("Authorization")
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// the proxy doesn't send anything after its response until the tunnel is used, so the reader can be dropped
+	res, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused the connection: %s", res.Status)
+	}
+	return conn, nil
+}
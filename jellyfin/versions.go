@@ -0,0 +1,63 @@
+package jellyfin
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/sj14/jellyfin-go/api"
+)
+
+// Versions of an item (e.g. 4K and 1080p) are its media sources, the first one is the one that gets played
+
+// Height of the video of a version, 0 if it has none
+func versionHeight(source api.MediaSourceInfo) int32 {
+	for _, stream := range source.MediaStreams {
+		if stream.GetType() == api.MEDIASTREAMTYPE_VIDEO {
+			return stream.GetHeight()
+		}
+	}
+	return 0
+}
+
+// Label of a version, the server names them after the file or the resolution
+func VersionName(source api.MediaSourceInfo) string {
+	name := source.GetName()
+	if name == "" {
+		name = source.GetId()
+	}
+	if height := versionHeight(source); height > 0 {
+		name += fmt.Sprintf(" (%dp)", height)
+	}
+	if bitrate := source.GetBitrate(); bitrate > 0 {
+		name += fmt.Sprintf(" %.1f Mbps", float64(bitrate)/1e6)
+	}
+	return name
+}
+
+// Copy of the item with the version with the id first, unchanged if there's no such version
+func WithVersion(item Item, id string) Item {
+	n := slices.IndexFunc(item.MediaSources, func(s api.MediaSourceInfo) bool { return s.GetId() == id })
+	if n <= 0 {
+		return item
+	}
+	sources := slices.Clone(item.MediaSources)
+	sources[0], sources[n] = sources[n], sources[0]
+	item.MediaSources = sources
+	return item
+}
+
+// Copy of the item with its highest or lowest resolution version first, ties go by bitrate
+func WithPreferredVersion(item Item, highest bool) Item {
+	if len(item.MediaSources) < 2 {
+		return item
+	}
+	best := slices.MaxFunc(item.MediaSources, func(a, b api.MediaSourceInfo) int {
+		c := cmp.Or(cmp.Compare(versionHeight(a), versionHeight(b)), cmp.Compare(a.GetBitrate(), b.GetBitrate()))
+		if !highest {
+			return -c
+		}
+		return c
+	})
+	return WithVersion(item, best.GetId())
+}
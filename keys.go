@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/spf13/viper"
+)
+
+type keyMap struct {
+	Up, Down         key.Binding
+	PrevTab, NextTab key.Binding
+	Search           key.Binding
+	Back             key.Binding
+	Play, PlayAlt    key.Binding
+	Continue         key.Binding
+	Random           key.Binding
+	Similar          key.Binding
+	Enqueue, Queue   key.Binding
+	Extras           key.Binding
+	Tracks           key.Binding
+	Watched          key.Binding
+	Favorite         key.Binding
+	Download         key.Binding
+	Shuffle          key.Binding
+	Repeat           key.Binding
+	Genre            key.Binding
+	Type             key.Binding
+	Unwatched        key.Binding
+	Sort, SortOrder  key.Binding
+	Library          key.Binding
+	Quality          key.Binding
+	Refresh          key.Binding
+	Help             key.Binding
+	Quit             key.Binding
+
+	// the list's paging, its defaults overlap with the tab and unwatched keys
+	PrevPage, NextPage, GoToStart, GoToEnd key.Binding
+	// only in the queue, where they shadow the keys above
+	QueuePlay, QueueMoveUp, QueueMoveDown, QueueRemove, QueueClear, QueueClose key.Binding
+}
+
+// Binding for an action with the keys from the keybindings config section, or the defaults
+func binding(action, help string, defaults ...string) key.Binding {
+	keys := defaults
+	if configured := viper.GetStringSlice("keybindings." + action); len(configured) > 0 {
+		keys = configured
+	}
+	return key.NewBinding(key.WithKeys(keys...), key.WithHelp(strings.Join(keys, "/"), help))
+}
+
+func newKeyMap() keyMap {
+	// the alternate play key does what play doesn't
+	playAltHelp := "play only this"
+	if !viper.GetBool("autoqueue") {
+		playAltHelp = "play with the series queued"
+	}
+	return keyMap{
+		Up:        binding("up", "move up", "up", "k"),
+		Down:      binding("down", "move down", "down", "j"),
+		PrevTab:   binding("prev_tab", "previous tab", "left", "h", "shift+tab"),
+		NextTab:   binding("next_tab", "next tab", "right", "l", "tab"),
+		Search:    binding("search", "search", "/"),
+		Back:      binding("back", "go back up", "backspace", "esc"),
+		Play:      binding("play", "play or open", "enter", "space"),
+		PlayAlt:   binding("play_alt", playAltHelp, "p"),
+		Continue:  binding("continue", "continue last series", "c"),
+		Random:    binding("random", "play a random unwatched one", "x"),
+		Similar:   binding("similar", "play with similar movies", "s"),
+		Enqueue:   binding("enqueue", "add to or remove from queue", "+"),
+		Queue:     binding("queue", "edit and play queue", "v"),
+		Extras:    binding("extras", "trailers and extras", "e"),
+		Tracks:    binding("tracks", "pick tracks and play", "a"),
+		Watched:   binding("watched", "toggle watched", "w"),
+		Favorite:  binding("favorite", "toggle favorite", "f"),
+		Download:  binding("download", "download", "d"),
+		Shuffle:   binding("shuffle", "toggle shuffle", "S"),
+		Repeat:    binding("repeat", "cycle repeat", "R"),
+		Genre:     binding("genre", "cycle genre filter", "g"),
+		Type:      binding("type", "cycle type filter", "t"),
+		Unwatched: binding("unwatched", "toggle unwatched only", "u"),
+		Sort:      binding("sort", "cycle sort", "o"),
+		SortOrder: binding("sort_order", "reverse sort", "O"),
+		Library:   binding("library", "cycle library of latest", "L"),
+		Quality:   binding("quality", "cycle quality", "Q"),
+		Refresh:   binding("refresh", "refresh", "r"),
+		Help:      binding("help", "toggle help", "?"),
+		Quit:      binding("quit", "quit", "q", "ctrl+c"),
+
+		PrevPage:  binding("prev_page", "previous page", "pgup", "b"),
+		NextPage:  binding("next_page", "next page", "pgdown"),
+		GoToStart: binding("go_to_start", "go to start", "home"),
+		GoToEnd:   binding("go_to_end", "go to end", "end", "G"),
+
+		QueuePlay:     binding("queue_play", "play from here", "enter"),
+		QueueMoveUp:   binding("queue_move_up", "move up", "K", "shift+up"),
+		QueueMoveDown: binding("queue_move_down", "move down", "J", "shift+down"),
+		QueueRemove:   binding("queue_remove", "remove", "d", "delete", "backspace"),
+		QueueClear:    binding("queue_clear", "clear", "C"),
+		QueueClose:    binding("queue_close", "back", "esc", "q"),
+	}
+}
+
+// Moves the list's own cursor keys to the configured ones, its help is replaced by the overlay
+func (k keyMap) applyTo(l *list.Model) {
+	l.KeyMap.CursorUp = k.Up
+	l.KeyMap.CursorDown = k.Down
+	l.KeyMap.PrevPage = k.PrevPage
+	l.KeyMap.NextPage = k.NextPage
+	l.KeyMap.GoToStart = k.GoToStart
+	l.KeyMap.GoToEnd = k.GoToEnd
+	l.KeyMap.Quit = k.Quit
+	l.KeyMap.ShowFullHelp.SetEnabled(false)
+	l.KeyMap.CloseFullHelp.SetEnabled(false)
+	l.SetShowHelp(false)
+}
+
+// Implements bubbles/help.KeyMap interface
+func (k keyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Play, k.Search, k.Help, k.Quit}
+}
+
+func (k keyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Up, k.Down, k.PrevTab, k.NextTab, k.Back},
+		{k.Play, k.PlayAlt, k.Continue, k.Random, k.Similar, k.Extras, k.Tracks, k.Enqueue, k.Queue},
+		{k.Search, k.Watched, k.Favorite, k.Download},
+		{k.Genre, k.Type, k.Unwatched, k.Sort, k.SortOrder, k.Library},
+		{k.Shuffle, k.Repeat, k.Quality, k.Refresh, k.Help, k.Quit},
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/adrg/xdg"
+	"github.com/hacel/jfsh/jellyfin"
+)
+
+// Every message and value is redacted, errors of requests carry the url with the token in it
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	switch v := a.Value.Any().(type) {
+	case string:
+		return slog.String(a.Key, jellyfin.Redact(v))
+	case error:
+		return slog.String(a.Key, jellyfin.Redact(v.Error()))
+	}
+	return a
+}
+
+// Sets up the default logger, json is meant for tools and for attaching to issues.
+// Without a file the TUI logs next to state.json, stderr would draw over it
+func setupLogging(format, file string, verbose, tui bool) (io.Closer, error) {
+	var w io.Writer = os.Stderr
+	var closer io.Closer
+	if file == "" && tui {
+		var err error
+		if file, err = xdg.StateFile("jfsh/jfsh.log"); err != nil {
+			return nil, fmt.Errorf("failed to find the log file: %w", err)
+		}
+	}
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		w, closer = f, f
+	}
+	options := &slog.HandlerOptions{Level: slog.LevelInfo, ReplaceAttr: redactAttr}
+	if verbose {
+		options.Level = slog.LevelDebug
+	}
+	switch format {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(w, options)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(w, options)))
+	default:
+		if closer != nil {
+			closer.Close()
+		}
+		return nil, fmt.Errorf("unknown log format %q, use text or json", format)
+	}
+	return closer, nil
+}
@@ -1,29 +1,149 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/hacel/jfsh/config"
+	"github.com/hacel/jfsh/jellyfin"
+	"github.com/hacel/jfsh/mpv"
 
 	"github.com/spf13/pflag"
 )
 
 func main() {
 	cfgPath := pflag.StringP("config", "c", "", "override path to configuration file")
+	serverName := pflag.StringP("server", "s", "", "name of the server profile to use, a new name adds a profile")
+	playId := pflag.String("play", "", "play the item with this id or link and exit, without the TUI. A link can also be passed on its own")
+	resume := pflag.Bool("resume", false, "with --play, start from the saved position instead of the beginning")
+	start := pflag.String("start", "", "with --play, start at this position, seconds or [hh:]mm:ss, instead of the beginning or the saved position")
+	logFormat := pflag.String("log-format", "text", "format of the log, text or json")
+	logFile := pflag.String("log-file", "", "append the log to this file, defaults to jfsh.log in the state dir, or stderr with --play")
+	verbose := pflag.BoolP("verbose", "v", false, "log debug messages too")
+	audioDevices := pflag.Bool("audio-devices", false, "list the audio devices audio_device can be set to and exit")
 	pflag.Parse()
 
+	if *playId == "" && pflag.NArg() == 1 {
+		*playId = pflag.Arg(0)
+	}
+	if *playId != "" {
+		id, ok := jellyfin.ParseItemLink(*playId)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "jfsh: %q is not an item id or a link to an item\n", *playId)
+			os.Exit(1)
+		}
+		*playId = id
+	}
+
+	startSecs := int64(-1) // from --resume or the beginning
+	if *start != "" {
+		secs, err := parseTimestamp(*start)
+		if err == nil && *playId == "" {
+			err = errors.New("--start only works with --play")
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "jfsh:", err)
+			os.Exit(1)
+		}
+		startSecs = secs
+	}
+
+	logs, err := setupLogging(*logFormat, *logFile, *verbose, *playId == "" && !*audioDevices)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "jfsh:", err)
+		os.Exit(1)
+	}
+
+	if *audioDevices {
+		err = listAudioDevices(*cfgPath)
+	} else {
+		err = run(*cfgPath, *serverName, *playId, *resume, startSecs)
+	}
+	if logs != nil {
+		logs.Close()
+	}
+	if err != nil {
+		// bubbletea has restored the terminal by the time Run returns
+		fmt.Fprintln(os.Stderr, "jfsh:", jellyfin.Redact(err.Error()))
+		os.Exit(1)
+	}
+}
+
+func run(cfgPath, serverName, playId string, resume bool, start int64) error {
 	// another bubbletea model that takes care of configuration and initializing the api client
 	const (
 		clientName    = "jfsh"
 		clientVersion = "0.1.0"
 	)
-	client := config.Run(clientName, clientVersion, *cfgPath)
+	client, err := config.Run(clientName, clientVersion, cfgPath, serverName)
+	if err != nil {
+		return err
+	}
 	if client == nil {
-		// err handling should happen inside the config model, this means the user quit
-		return
+		// err handling for the login happens inside the config model, this means the user quit
+		return nil
+	}
+	defer client.Close()
+
+	if playId != "" {
+		return playItem(client, playId, resume, start)
 	}
 
 	p := tea.NewProgram(initialModel(client), tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
-		panic(err)
+	_, err = p.Run()
+	return err
+}
+
+// Headless playback of a single item for scripts and keybindings, start is in seconds and wins over resume
+// unless it's negative
+func playItem(client *jellyfin.Client, id string, resume bool, start int64) error {
+	item, err := client.GetItem(id)
+	if err != nil {
+		return fmt.Errorf("failed to get item %q: %w", id, err)
+	}
+	if start < 0 {
+		start = 0
+		if resume {
+			start = mpv.GetResumeStart(item)
+		}
+	}
+	summary, err := mpv.Play(client, []jellyfin.Item{item}, 0, start, nil)
+	if line := summary.String(); line != "" {
+		fmt.Println(line)
+	}
+	return err
+}
+
+// Seconds, mm:ss or hh:mm:ss
+func parseTimestamp(s string) (int64, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid position %q, use seconds or [hh:]mm:ss", s)
+	}
+	var secs int64
+	for i, part := range parts {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 0 || (i > 0 && n >= 60) {
+			return 0, fmt.Errorf("invalid position %q, use seconds or [hh:]mm:ss", s)
+		}
+		secs = secs*60 + n
+	}
+	return secs, nil
+}
+
+// Doesn't need a server, only mpv
+func listAudioDevices(cfgPath string) error {
+	config.Load(cfgPath)
+	devices, err := mpv.ListAudioDevices()
+	if err != nil {
+		return err
+	}
+	for _, d := range devices {
+		fmt.Printf("%s\t%s\n", d.Name, d.Description)
 	}
+	return nil
 }
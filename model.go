@@ -1,34 +1,128 @@
 package main
 
 import (
+	"time"
+
+	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 	"github.com/hacel/jfsh/jellyfin"
+	"github.com/hacel/jfsh/mpv"
+	"github.com/sj14/jellyfin-go/api"
+	"github.com/spf13/viper"
 )
 
 type model struct {
 	err error
 
 	client *jellyfin.Client
+	keys   keyMap
+	help   help.Model
+
+	showHelp bool
 
 	tabs      []string
 	activeTab int
+	tabCache  map[string][]jellyfin.Item // last items of every tab that was fetched
+	tabErrs   map[string]error           // error of the last fetch of every tab
+	loading   map[string]int             // fetches in flight by tab
+
+	spinner  spinner.Model
+	spinning bool // a tick is pending, so starting it again would double the speed
 
 	list list.Model
 
-	playing *item
+	search    textinput.Model
+	searchSeq int // incremented on every keystroke to debounce queries
+
+	filter    jellyfin.Filter // applied to search and library results
+	unwatched map[string]bool // tabs that only show what wasn't watched, from unwatched_only
+	genres    []string        // choices for the genre filter, fetched the first time it's used
+	sort      jellyfin.Sort   // applied to latest and library results
+
+	libraries     []jellyfin.Item // choices for the library of latest, fetched the first time it's picked
+	latestLibrary jellyfin.Item   // latest only shows items from it, the zero value for every library
+
+	parents  []browseLevel   // folders entered on the library tab
+	expanded map[string]bool // seasons expanded or collapsed in this session, by season id
+	restored int             // selection to restore once the items of a level arrive
+
+	width, height int
+
+	images    map[string]string // rendered artwork by item id, nil when images are off
+	remaining map[string]string // runtime left by series id
+
+	downloads map[string]download // running downloads by item id
+
+	pickVersion   *item       // asking which version to play, with media_version ask
+	pickTracks    bool        // the track menu opens once the version is picked
+	trackMenu     *trackMenu  // picking the tracks to play with
+	confirmResume *item       // asking whether to resume or start over
+	queue         bool        // whether the item being confirmed is played with its series queued
+	tracks        *mpv.Tracks // picked in the track menu for the item being confirmed, nil if it wasn't used
+	playQueue     *playQueue
+	playing       *item
+	summary       string // of the last playback, shown until a key is pressed
+}
+
+type browseLevel struct {
+	parent   item
+	selected int  // selected index in the level above, restored when going back up
+	extras   bool // the trailers and special features of parent instead of its children
 }
 
 func initialModel(client *jellyfin.Client) model {
+	applyTheme(loadTheme())
 	m := model{
-		client: client,
-		tabs:   []string{"Resume", "Next Up", "Latest"},
-		list:   list.New(nil, list.NewDefaultDelegate(), 0, 0),
+		client:    client,
+		keys:      newKeyMap(),
+		help:      help.New(),
+		tabs:      []string{"Resume", "Next Up", "Latest", "Favorites", "Collections", "Playlists", "Library", "Search"},
+		tabCache:  map[string][]jellyfin.Item{},
+		tabErrs:   map[string]error{},
+		loading:   map[string]int{},
+		spinner:   spinner.New(spinner.WithSpinner(spinner.Dot), spinner.WithStyle(lipgloss.NewStyle().Foreground(activeTabColor))),
+		remaining: map[string]string{},
+		downloads: map[string]download{},
+		expanded:  map[string]bool{},
+		unwatched: map[string]bool{},
+		playQueue: &playQueue{},
+		list:      list.New(nil, newDelegate(), 0, 0),
+		search:    textinput.New(),
+	}
+	m.client.SetCacheTTL(time.Duration(viper.GetInt("cache_ttl_seconds")) * time.Second)
+	m.client.SetLimits(jellyfin.Limits{Latest: viper.GetInt32("latest_limit"), Search: viper.GetInt32("search_limit")})
+	m.sort = jellyfin.Sort{By: api.ItemSortBy(viper.GetString("sort_by")), Descending: viper.GetBool("sort_descending")}
+	for _, tab := range viper.GetStringSlice("unwatched_only") {
+		m.unwatched[tab] = true
 	}
 	m.list.SetShowTitle(false)
+	m.keys.applyTo(&m.list)
+	if imagesEnabled() {
+		m.images = map[string]string{}
+	}
+	m.search.Placeholder = "Search"
 	return m
 }
 
+// The first tabs are fetched all at once so switching to them is instant
 func (m model) Init() tea.Cmd {
-	return m.fetchActiveTabItems
+	return tea.Batch(m.fetchTab("Resume"), m.fetchTab("Next Up"), m.fetchTab("Latest"))
+}
+
+// Something the user is waiting for, the active tab loading or mpv starting
+func (m model) busy() bool {
+	return m.loading[m.tabs[m.activeTab]] > 0 || m.playing != nil
+}
+
+// Starts the spinner unless it's already going, it stops by itself once nothing is busy
+func (m *model) spin() tea.Cmd {
+	if m.spinning {
+		return nil
+	}
+	m.spinning = true
+	return m.spinner.Tick
 }
@@ -2,30 +2,761 @@ package mpv
 
 import (
 	"fmt"
+	"log/slog"
+	"math"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/hacel/jfsh/discord"
 	"github.com/hacel/jfsh/jellyfin"
+	"github.com/hacel/jfsh/state"
+	"github.com/hacel/jfsh/trakt"
 	"github.com/sj14/jellyfin-go/api"
+	"github.com/spf13/viper"
 )
 
-func getUrl(item jellyfin.Item) string {
-	url := fmt.Sprintf("%s/videos/%s/stream?static=true", "https://jf.sammar.sa", *item.Id)
+// Wraps the url in an edl so mpv doesn't try to interpret any of it
+func edlUrl(url string) string {
 	return fmt.Sprintf("edl://%%%d%%%s", len(url), url)
 }
 
+// Title from the title_format template for the item's type, other types use the path
 func getMediaTitle(item jellyfin.Item) string {
-	title := item.GetPath()
+	var format string
 	switch item.GetType() {
 	case api.BASEITEMKIND_MOVIE:
-		title = fmt.Sprintf("%s (%d)", item.GetName(), item.GetProductionYear())
+		format = viper.GetString("title_format.movie")
 	case api.BASEITEMKIND_EPISODE:
-		title = fmt.Sprintf("%s S%.2dE%.2d %s", item.GetSeriesName(), item.GetParentIndexNumber(), item.GetIndexNumber(), item.GetName())
+		format = viper.GetString("title_format.episode")
 	}
-	return title
+	if format == "" {
+		return item.GetPath()
+	}
+	return strings.NewReplacer(
+		"{name}", item.GetName(),
+		"{year}", strconv.Itoa(int(item.GetProductionYear())),
+		"{series}", item.GetSeriesName(),
+		"{season}", fmt.Sprintf("%.2d", item.GetParentIndexNumber()),
+		"{episode}", fmt.Sprintf("%.2d", item.GetIndexNumber()),
+	).Replace(format)
+}
+
+// nil when discord_presence is off or Discord isn't running, the presence methods do nothing on nil
+func connectPresence() *discord.Presence {
+	if !viper.GetBool("discord_presence") {
+		return nil
+	}
+	p, err := discord.Connect(viper.GetString("discord_client_id"))
+	if err != nil {
+		slog.Debug("no discord presence", "err", err)
+		return nil
+	}
+	return p
+}
+
+// nil when remote_control is off or the session socket can't be opened, Close does nothing on nil
+func connectRemote(client *jellyfin.Client, handle func(jellyfin.RemoteCommand)) *jellyfin.Remote {
+	if !viper.GetBool("remote_control") {
+		return nil
+	}
+	r, err := client.ListenRemote(handle)
+	if err != nil {
+		slog.Error("failed to connect remote control", "err", err)
+		return nil
+	}
+	return r
+}
+
+func updatePresence(p *discord.Presence, item jellyfin.Item, state jellyfin.PlayState) {
+	details, status := "Watching "+item.GetName(), ""
+	if item.GetType() == api.BASEITEMKIND_EPISODE {
+		details = fmt.Sprintf("Watching %s S%.2dE%.2d", item.GetSeriesName(), item.GetParentIndexNumber(), item.GetIndexNumber())
+		status = item.GetName()
+	}
+	var started time.Time
+	if state.Paused {
+		status = "Paused"
+	} else {
+		started = time.Now().Add(-time.Duration(state.Position) * time.Second)
+	}
+	if err := p.SetActivity(details, status, started); err != nil {
+		slog.Debug("failed to update discord presence", "err", err)
+	}
+}
+
+// nil when trakt_token isn't set, scrobbling on nil does nothing
+func newTrakt() *trakt.Client {
+	if viper.GetString("trakt_token") == "" {
+		return nil
+	}
+	return trakt.NewClient(viper.GetString("trakt_client_id"), viper.GetString("trakt_token"))
+}
+
+// Trakt ids of the item from its provider ids, ok=false if it has none Trakt understands
+func traktMedia(item jellyfin.Item) (media trakt.Media, ok bool) {
+	media.Episode = item.GetType() == api.BASEITEMKIND_EPISODE
+	media.Ids = map[string]any{}
+	for key, value := range item.GetProviderIds() {
+		switch key := strings.ToLower(key); key {
+		case "imdb":
+			media.Ids[key] = value
+		case "tmdb", "tvdb":
+			if id, err := strconv.Atoi(value); err == nil {
+				media.Ids[key] = id
+			}
+		}
+	}
+	return media, len(media.Ids) > 0
+}
+
+// Mirrors a playback event to Trakt, action is start, pause or stop
+func scrobble(t *trakt.Client, action string, item jellyfin.Item, pos int64) {
+	if t == nil {
+		return
+	}
+	media, ok := traktMedia(item)
+	if !ok {
+		slog.Debug("not scrobbling item without provider ids", "id", item.GetId())
+		return
+	}
+	var progress float64
+	if runtime := item.GetRunTimeTicks() / 10000000; runtime > 0 {
+		progress = min(float64(pos)/float64(runtime)*100, 100)
+	}
+	if err := t.Scrobble(action, media, progress); err != nil {
+		slog.Error("failed to scrobble to trakt", "err", err)
+	}
+}
+
+// The downloaded file if there is one, so it plays without the server, otherwise the stream
+func getPlaybackURL(client *jellyfin.Client, item jellyfin.Item) (string, error) {
+	if path, ok := getDownload(item.GetId()); ok {
+		return path, nil
+	}
+	stream, err := client.GetStreamingURL(item, getStreamOptions())
+	if err != nil {
+		return "", err
+	}
+	if u, err := url.Parse(stream); err != nil || u.Host == "" {
+		return "", fmt.Errorf("%w, the server sent %q", jellyfin.ErrNoMediaSource, stream)
+	}
+	return stream, nil
+}
+
+// Drops the items that have nothing to stream, e.g. missing episodes, so mpv doesn't end up with an empty
+// window. Fails if the one to start with is one of them
+func getPlayable(items []jellyfin.Item, index int) ([]jellyfin.Item, int, error) {
+	hasSource := func(item jellyfin.Item) bool { return len(item.MediaSources) > 0 || IsDownloaded(item) }
+	if !hasSource(items[index]) {
+		return nil, 0, fmt.Errorf("%s can't be played: %w", getMediaTitle(items[index]), jellyfin.ErrNoMediaSource)
+	}
+	var playable []jellyfin.Item
+	start := 0
+	for i, item := range items {
+		if i == index {
+			start = len(playable)
+		}
+		if hasSource(item) {
+			playable = append(playable, preferVersion(item))
+		}
+	}
+	return playable, start, nil
+}
+
+// media_version highest or lowest picks the version of every item, ask is handled before playback starts
+func preferVersion(item jellyfin.Item) jellyfin.Item {
+	switch viper.GetString("media_version") {
+	case "highest":
+		return jellyfin.WithPreferredVersion(item, true)
+	case "lowest":
+		return jellyfin.WithPreferredVersion(item, false)
+	}
+	return item
+}
+
+// Path of a downloaded item that's still there
+func getDownload(id string) (string, bool) {
+	s, err := state.Get()
+	if err != nil {
+		slog.Error("failed to read state", "err", err)
+		return "", false
+	}
+	path, ok := s.Downloads[id]
+	if !ok {
+		return "", false
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+func IsDownloaded(item jellyfin.Item) bool {
+	_, ok := getDownload(item.GetId())
+	return ok
+}
+
+func SaveDownload(item jellyfin.Item, path string) error {
+	return state.Update(func(s *state.State) {
+		if s.Downloads == nil {
+			s.Downloads = map[string]string{}
+		}
+		s.Downloads[item.GetId()] = path
+	})
 }
 
-func getResumePosition(item jellyfin.Item) (secs int64) {
-	if item.UserData.IsSet() {
+func getStreamOptions() jellyfin.StreamOptions {
+	return jellyfin.StreamOptions{
+		ForceTranscode: viper.GetBool("force_transcode"),
+		MaxBitrate:     int32(viper.GetInt("max_bitrate")),
+	}
+}
+
+// mpv args for window_mode, they come before mpv_args so those still win
+func getWindowArgs() []string {
+	switch mode := viper.GetString("window_mode"); mode {
+	case "":
+		return nil
+	case "fullscreen":
+		return []string{"--fs"}
+	case "windowed":
+		return []string{"--no-fs", "--border"}
+	case "borderless":
+		return []string{"--no-fs", "--no-border"}
+	default:
+		slog.Error("invalid window_mode", "mode", mode)
+		return nil
+	}
+}
+
+// Entry of mpv's audio-device-list, audio_device takes the name
+type AudioDevice struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// The device after current in the list, wrapping around to the first
+func nextAudioDevice(devices []AudioDevice, current string) (AudioDevice, bool) {
+	if len(devices) == 0 {
+		return AudioDevice{}, false
+	}
+	n := slices.IndexFunc(devices, func(d AudioDevice) bool { return d.Name == current })
+	return devices[(n+1)%len(devices)], true
+}
+
+// Turns command line style mpv_args (--profile=fast, --fs, --no-border) into option names and values
+func parseMpvArgs(args []string) [][2]string {
+	var options [][2]string
+	for _, arg := range args {
+		arg = strings.TrimPrefix(arg, "--")
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			value = "yes"
+			if after, found := strings.CutPrefix(name, "no-"); found {
+				name, value = after, "no"
+			}
+		}
+		options = append(options, [2]string{name, value})
+	}
+	return options
+}
+
+// Stopping after watched_threshold percent of the runtime marks the item watched,
+// even if the server's own threshold is higher. 0 leaves it to the server
+func isWatched(item jellyfin.Item, pos int64) bool {
+	threshold := viper.GetFloat64("watched_threshold")
+	runtime := item.GetRunTimeTicks() / 10000000
+	return threshold > 0 && runtime > 0 && float64(pos) >= float64(runtime)*threshold/100
+}
+
+// Where resuming the item starts, resume_rewind_seconds before the saved position so there's a moment to
+// catch up on what was going on
+func GetResumeStart(item jellyfin.Item) int64 {
+	pos := GetResumePosition(item)
+	if pos <= 0 {
+		return 0
+	}
+	return max(pos-viper.GetInt64("resume_rewind_seconds"), 0)
+}
+
+// Saved position of the item in seconds, 0 if there is none. The position kept locally
+// is used when it's ahead of the server's, i.e. the last session didn't end cleanly
+func GetResumePosition(item jellyfin.Item) (secs int64) {
+	if item.UserData.IsSet() && item.UserData.Get().PlaybackPositionTicks != nil {
 		secs = *item.UserData.Get().PlaybackPositionTicks / 10000000
 	}
+	s, err := state.Get()
+	if err != nil {
+		slog.Error("failed to read state", "err", err)
+		return
+	}
+	if local, ok := s.Positions[item.GetId()]; ok && local > secs {
+		secs = local
+	}
 	return
 }
+
+// mpv numbers tracks of each type starting from 1 in the order they appear in the file,
+// jellyfin indexes all streams of the file together. External subtitles come after the
+// embedded ones, in the order addExternalSubtitles adds them
+func getTrackStreams(item jellyfin.Item, streamType api.MediaStreamType) []api.MediaStream {
+	var streams []api.MediaStream
+	for _, stream := range jellyfin.GetMediaStreams(item) {
+		if stream.GetType() == streamType && !stream.GetIsExternal() {
+			streams = append(streams, stream)
+		}
+	}
+	if streamType == api.MEDIASTREAMTYPE_SUBTITLE {
+		streams = append(streams, jellyfin.GetExternalSubtitleStreams(item)...)
+	}
+	return streams
+}
+
+func getTrackId(item jellyfin.Item, streamType api.MediaStreamType, index int32) (id int64, ok bool) {
+	for i, stream := range getTrackStreams(item, streamType) {
+		if stream.GetIndex() == index {
+			return int64(i + 1), true
+		}
+	}
+	return 0, false
+}
+
+// Inverse of getTrackId
+func getStreamIndex(item jellyfin.Item, streamType api.MediaStreamType, id int64) (index int32, ok bool) {
+	streams := getTrackStreams(item, streamType)
+	if id < 1 || id > int64(len(streams)) {
+		return 0, false
+	}
+	return streams[id-1].GetIndex(), true
+}
+
+// Audio track the server would pick, this follows the user's remembered selection
+func getDefaultAudioTrackId(item jellyfin.Item) (id int64, ok bool) {
+	if len(item.MediaSources) == 0 || item.MediaSources[0].DefaultAudioStreamIndex.Get() == nil {
+		return 0, false
+	}
+	return getTrackId(item, api.MEDIASTREAMTYPE_AUDIO, *item.MediaSources[0].DefaultAudioStreamIndex.Get())
+}
+
+// Signs and songs or forced subtitles only cover part of the dialogue
+var partialSubtitleTitle = regexp.MustCompile(`(?i)\b(signs|songs|forced)\b`)
+
+func isPartialSubtitle(stream api.MediaStream) bool {
+	return stream.GetIsForced() || partialSubtitleTitle.MatchString(stream.GetTitle()) || partialSubtitleTitle.MatchString(stream.GetDisplayTitle())
+}
+
+// First of the subtitle streams matching the preferred languages in priority order,
+// a full one is preferred over signs and forced ones of the same language unless prefer_full_subs is off
+func getPreferredSubtitleTrackId(item jellyfin.Item, langs []string, streams []api.MediaStream) (id int64, ok bool) {
+	preferFull := viper.GetBool("prefer_full_subs")
+	for _, lang := range langs {
+		match := -1
+		for i, stream := range streams {
+			if !strings.EqualFold(stream.GetLanguage(), lang) {
+				continue
+			}
+			if match < 0 || (preferFull && isPartialSubtitle(streams[match]) && !isPartialSubtitle(stream)) {
+				match = i
+			}
+		}
+		if match >= 0 {
+			return getTrackId(item, api.MEDIASTREAMTYPE_SUBTITLE, streams[match].GetIndex())
+		}
+	}
+	return 0, false
+}
+
+// Subtitle track to start with: a forced one in the audio language when that's one of sub_langs, it only
+// translates the foreign dialogue of something the user understands, otherwise the preferred languages
+// apply. With forced_subs_only nothing but forced ones are picked
+func getSubtitleTrackId(item jellyfin.Item, audioLang string, streams []api.MediaStream) (id int64, ok bool) {
+	langs := viper.GetStringSlice("sub_langs")
+	var forced []api.MediaStream
+	for _, stream := range streams {
+		if isPartialSubtitle(stream) {
+			forced = append(forced, stream)
+		}
+	}
+	if audioLang != "" && slices.ContainsFunc(langs, func(lang string) bool { return strings.EqualFold(lang, audioLang) }) {
+		if id, ok := getPreferredSubtitleTrackId(item, []string{audioLang}, forced); ok {
+			return id, true
+		}
+	}
+	if viper.GetBool("forced_subs_only") {
+		streams = forced
+	}
+	return getPreferredSubtitleTrackId(item, langs, streams)
+}
+
+// First embedded track of the type in the language
+func getTrackIdByLanguage(item jellyfin.Item, streamType api.MediaStreamType, lang string) (id int64, ok bool) {
+	for _, stream := range jellyfin.GetMediaStreams(item) {
+		if stream.GetType() == streamType && !stream.GetIsExternal() && strings.EqualFold(stream.GetLanguage(), lang) {
+			return getTrackId(item, streamType, stream.GetIndex())
+		}
+	}
+	return 0, false
+}
+
+func getStreamLanguage(item jellyfin.Item, index int32) string {
+	for _, stream := range jellyfin.GetMediaStreams(item) {
+		if stream.GetIndex() == index {
+			return stream.GetLanguage()
+		}
+	}
+	return ""
+}
+
+// The server reports HDR10, HLG and Dolby Vision all as HDR
+func isHDR(item jellyfin.Item) bool {
+	for _, stream := range jellyfin.GetMediaStreams(item) {
+		if stream.GetType() == api.MEDIASTREAMTYPE_VIDEO && stream.GetVideoRange() == api.VIDEORANGE_HDR {
+			return true
+		}
+	}
+	return false
+}
+
+// Options that tone map an HDR item for an SDR display, without them it looks washed out on displays mpv
+// can't tell apart. hdr_tonemap is one of mpv's tone-mapping curves, e.g. auto or bt.2390, empty turns it off
+func getToneMappingOptions(item jellyfin.Item) [][2]string {
+	curve := viper.GetString("hdr_tonemap")
+	if curve == "" || !isHDR(item) {
+		return nil
+	}
+	return [][2]string{
+		{"tone-mapping", curve},
+		{"hdr-compute-peak", "yes"},
+		{"target-prim", "bt.709"},
+		{"target-trc", "bt.1886"},
+	}
+}
+
+// Tracks picked in jfsh before playback by jellyfin stream index, they win over every other selection.
+// Audio -1 leaves the audio to mpv, Subtitle -1 turns subtitles off
+type Tracks struct {
+	Audio, Subtitle int32
+}
+
+// mpv's aid and sid for picked tracks, empty to leave one as it is
+func getPickedTrackIds(item jellyfin.Item, tracks Tracks) (aid, sid string) {
+	if id, ok := getTrackId(item, api.MEDIASTREAMTYPE_AUDIO, tracks.Audio); ok {
+		aid = strconv.FormatInt(id, 10)
+	}
+	sid = "no"
+	if tracks.Subtitle >= 0 {
+		sid = ""
+		if id, ok := getTrackId(item, api.MEDIASTREAMTYPE_SUBTITLE, tracks.Subtitle); ok {
+			sid = strconv.FormatInt(id, 10)
+		}
+	}
+	return aid, sid
+}
+
+// Languages of the selected tracks, by jellyfin stream index with -1 for subtitles off
+func getTracks(item jellyfin.Item, audio, subtitle *int32) state.Tracks {
+	var tracks state.Tracks
+	if audio != nil {
+		tracks.Audio = getStreamLanguage(item, *audio)
+	}
+	if subtitle != nil {
+		if *subtitle < 0 {
+			tracks.SubtitlesOff = true
+		} else {
+			tracks.Subtitle = getStreamLanguage(item, *subtitle)
+		}
+	}
+	return tracks
+}
+
+// Tracks picked for another episode of the same series
+func getSeriesTracks(item jellyfin.Item) (state.Tracks, bool) {
+	if !viper.GetBool("remember_series_tracks") || item.GetSeriesId() == "" {
+		return state.Tracks{}, false
+	}
+	s, err := state.Get()
+	if err != nil {
+		slog.Error("failed to read state", "err", err)
+		return state.Tracks{}, false
+	}
+	tracks, ok := s.SeriesTracks[item.GetSeriesId()]
+	return tracks, ok
+}
+
+func saveSeriesTracks(item jellyfin.Item, tracks state.Tracks) error {
+	if !viper.GetBool("remember_series_tracks") || item.GetSeriesId() == "" {
+		return nil
+	}
+	return state.Update(func(s *state.State) {
+		if s.SeriesTracks == nil {
+			s.SeriesTracks = map[string]state.Tracks{}
+		}
+		s.SeriesTracks[item.GetSeriesId()] = tracks
+	})
+}
+
+// Part of an item that gets skipped over, in seconds
+type segment struct {
+	name  string
+	start int64
+	end   float64 // where the skip lands, skip_padding_seconds after the end
+}
+
+// Compiles the skip_chapters config, invalid patterns are logged and ignored
+func getSkipPatterns() []*regexp.Regexp {
+	var patterns []*regexp.Regexp
+	for _, p := range viper.GetStringSlice("skip_chapters") {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			slog.Error("invalid skip_chapters pattern", "pattern", p, "err", err)
+			continue
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns
+}
+
+// Chapters whose name matches one of the patterns, a chapter ends where the next one starts
+func getSkippableSegments(item jellyfin.Item, patterns []*regexp.Regexp) []segment {
+	padding := viper.GetFloat64("skip_padding_seconds")
+	var segments []segment
+	chapters := item.GetChapters()
+	for i, chapter := range chapters {
+		end := item.GetRunTimeTicks()
+		if i+1 < len(chapters) {
+			end = chapters[i+1].GetStartPositionTicks()
+		}
+		for _, re := range patterns {
+			if re.MatchString(chapter.GetName()) {
+				segments = append(segments, segment{
+					name:  chapter.GetName(),
+					start: chapter.GetStartPositionTicks() / 10000000,
+					end:   float64(end)/10000000 + padding,
+				})
+				break
+			}
+		}
+	}
+	return segments
+}
+
+// Entry of mpv's chapter-list, time is in seconds
+type chapter struct {
+	Title string  `json:"title"`
+	Time  float64 `json:"time"`
+}
+
+// OSD list of the chapters with the current one marked and the ones that get skipped labeled
+func formatChapters(chapters []chapter, current int64, segments []segment) string {
+	var b strings.Builder
+	for i, c := range chapters {
+		marker := "  "
+		if int64(i) == current {
+			marker = "▸ "
+		}
+		title := c.Title
+		if title == "" {
+			title = fmt.Sprintf("Chapter %d", i+1)
+		}
+		fmt.Fprintf(&b, "%s%s %s", marker, formatTime(int64(c.Time)), title)
+		if slices.ContainsFunc(segments, func(s segment) bool { return s.name == c.Title && s.start == int64(c.Time) }) {
+			b.WriteString(" (skipped)")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Runtime of the episodes that come right after items[current] in the same season, in seconds
+func getSeasonRest(items []jellyfin.Item, current int) int64 {
+	season := items[current].GetSeasonId()
+	if items[current].GetType() != api.BASEITEMKIND_EPISODE || season == "" {
+		return 0
+	}
+	var ticks int64
+	for _, item := range items[current+1:] {
+		if item.GetSeasonId() != season {
+			break
+		}
+		ticks += item.GetRunTimeTicks()
+	}
+	return ticks / 10000000
+}
+
+// Title with the runtime when the file starts, later with the time left in the file and the season
+func formatInfo(item jellyfin.Item, pos, seasonRest int64, started bool) string {
+	runtime := item.GetRunTimeTicks() / 10000000
+	if runtime <= 0 {
+		return getMediaTitle(item)
+	}
+	if started {
+		return fmt.Sprintf("%s · %s", getMediaTitle(item), formatTime(runtime))
+	}
+	left := max(runtime-pos, 0)
+	info := fmt.Sprintf("%s · %s left", getMediaTitle(item), formatTime(left))
+	if seasonRest > 0 {
+		info += fmt.Sprintf(" · %s left in season %d", formatTime(left+seasonRest), item.GetParentIndexNumber())
+	}
+	return info
+}
+
+// Forgets the file that's playing and reports it stopped. End-file, the next start-file and Play returning all
+// call it, only the first one after a file started reports anything
+func stopFile(item **jellyfin.Item, report func(jellyfin.Item)) {
+	if *item == nil {
+		return
+	}
+	stopped := **item
+	// before reporting, a panic in report mustn't get it reported again by the deferred stop
+	*item = nil
+	report(stopped)
+}
+
+// What a Play did, shown once mpv exits
+type Summary struct {
+	Items    int    // how many files played
+	Title    string // of the last one
+	Watched  int64  // seconds played over all of them, seeking doesn't count
+	Played   bool   // the last one was marked played
+	Reported bool   // the server got the stop of the last one
+}
+
+// One line, empty if nothing played
+func (s Summary) String() string {
+	if s.Items == 0 {
+		return ""
+	}
+	line := fmt.Sprintf("Watched %s of %s", formatTime(s.Watched), s.Title)
+	if s.Items > 1 {
+		line = fmt.Sprintf("Watched %s over %d items, the last was %s", formatTime(s.Watched), s.Items, s.Title)
+	}
+	if s.Played {
+		line += ", marked played"
+	}
+	if !s.Reported {
+		line += ". The server didn't get the stop, it might still show it as playing"
+	}
+	return line
+}
+
+// h:mm:ss or m:ss
+func formatTime(secs int64) string {
+	h, m, s := secs/3600, secs/60%60, secs%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+func isInsideSkippableSegment(segments []segment, pos int64) (segment, bool) {
+	for _, s := range segments {
+		// pos is in whole seconds, landing on a fraction before the end doesn't count as inside again
+		if pos >= s.start && float64(pos) < math.Floor(s.end) {
+			return s, true
+		}
+	}
+	return segment{}, false
+}
+
+// Volume override of the item, or the last volume used
+func getSavedVolume(itemId string) (float64, bool) {
+	s, err := state.Get()
+	if err != nil {
+		slog.Error("failed to read state", "err", err)
+		return 0, false
+	}
+	if v, ok := s.ItemVolume[itemId]; ok {
+		return v, true
+	}
+	if s.Volume != nil {
+		return *s.Volume, true
+	}
+	return 0, false
+}
+
+// Volume was changed while playing the item, remember it for the item and as the new default
+func saveVolume(itemId string, volume float64) error {
+	return state.Update(func(s *state.State) {
+		s.Volume = &volume
+		if s.ItemVolume == nil {
+			s.ItemVolume = map[string]float64{}
+		}
+		s.ItemVolume[itemId] = volume
+	})
+}
+
+func savePosition(itemId string, pos int64) error {
+	return state.Update(func(s *state.State) {
+		if s.Positions == nil {
+			s.Positions = map[string]int64{}
+		}
+		s.Positions[itemId] = pos
+	})
+}
+
+// Once the server has the final position the local one isn't needed anymore
+func clearPosition(itemId string) error {
+	return state.Update(func(s *state.State) {
+		delete(s.Positions, itemId)
+	})
+}
+
+func saveLastEpisode(item jellyfin.Item) error {
+	return state.Update(func(s *state.State) {
+		s.LastEpisode = &state.Episode{SeriesId: item.GetSeriesId(), EpisodeId: item.GetId()}
+	})
+}
+
+// Series and episode that were playing when playback last stopped
+func GetLastEpisode() (seriesId, episodeId string, ok bool) {
+	s, err := state.Get()
+	if err != nil {
+		slog.Error("failed to read state", "err", err)
+		return "", "", false
+	}
+	if s.LastEpisode == nil {
+		return "", "", false
+	}
+	return s.LastEpisode.SeriesId, s.LastEpisode.EpisodeId, true
+}
+
+// video_aspect_override takes the same values as mpv, e.g. 16:9 or 2.35, empty or -1 for no override
+func parseAspect(s string) float64 {
+	if w, h, ok := strings.Cut(s, ":"); ok {
+		wf, werr := strconv.ParseFloat(w, 64)
+		hf, herr := strconv.ParseFloat(h, 64)
+		if werr == nil && herr == nil && hf > 0 {
+			return wf / hf
+		}
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return -1
+}
+
+// Crop remembered for the item, or the configured one
+func getCrop(itemId string) state.Crop {
+	s, err := state.Get()
+	if err != nil {
+		slog.Error("failed to read state", "err", err)
+	}
+	if crop, ok := s.ItemCrop[itemId]; ok {
+		return crop
+	}
+	return state.Crop{Aspect: parseAspect(viper.GetString("video_aspect_override")), Panscan: viper.GetFloat64("panscan")}
+}
+
+func saveCrop(itemId string, crop state.Crop) error {
+	return state.Update(func(s *state.State) {
+		if s.ItemCrop == nil {
+			s.ItemCrop = map[string]state.Crop{}
+		}
+		s.ItemCrop[itemId] = crop
+	})
+}
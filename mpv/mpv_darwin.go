@@ -1,9 +1,110 @@
 package mpv
 
-import "os/exec"
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
 
-// TODO: finish the rest of this function
-func Play(filename string) {
-	c := exec.Command("mpv", filename)
-	c.Run()
+	"github.com/hacel/jfsh/jellyfin"
+	"github.com/spf13/viper"
+)
+
+// TODO: finish the rest of this function, nothing is reported back to the server yet
+func Play(client *jellyfin.Client, items []jellyfin.Item, index int, start int64, picked *Tracks) (Summary, error) {
+	items, index, err := getPlayable(items, index)
+	if err != nil {
+		return Summary{}, err
+	}
+	path, err := exec.LookPath(viper.GetString("mpv_path"))
+	if err != nil {
+		return Summary{}, fmt.Errorf("mpv was not found in PATH (%s), install it or set mpv_path and try again", os.Getenv("PATH"))
+	}
+	// no way to extend the playlist later here, so only the window around the chosen item is passed
+	window := max(viper.GetInt("playlist_window"), 1)
+	lo, hi := max(index-window, 0), min(index+window+1, len(items))
+	items, index = items[lo:hi], index-lo
+	args := []string{"--playlist-start=" + strconv.Itoa(index)}
+	if codepage := viper.GetString("subtitle_codepage"); codepage != "" {
+		args = append(args, "--sub-codepage="+codepage)
+	}
+	if device := viper.GetString("audio_device"); device != "" {
+		args = append(args, "--audio-device="+device)
+	}
+	args = append(args, getWindowArgs()...)
+	args = append(args, viper.GetStringSlice("mpv_args")...)
+	for i, item := range items {
+		url, err := getPlaybackURL(client, item)
+		if err != nil {
+			return Summary{}, err
+		}
+		var options []string
+		for _, option := range getToneMappingOptions(item) {
+			options = append(options, "--"+option[0]+"="+option[1])
+		}
+		if i == index && start > 0 {
+			// --start on its own would apply to every file
+			options = append(options, "--start="+strconv.FormatInt(start, 10))
+		}
+		if i == index && picked != nil {
+			// external subtitles aren't added here so only embedded ones can be picked
+			aid, sid := getPickedTrackIds(item, *picked)
+			if aid != "" {
+				options = append(options, "--aid="+aid)
+			}
+			if sid != "" {
+				options = append(options, "--sid="+sid)
+			}
+		}
+		if len(options) == 0 {
+			args = append(args, url)
+			continue
+		}
+		// per file options
+		args = append(args, "--{")
+		args = append(args, options...)
+		args = append(args, url, "--}")
+	}
+	cmd := exec.Command(path, args...)
+	// mpv's own messages are the only hint why it didn't start
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := lastLines(stderr.String(), 5); msg != "" {
+			return Summary{}, fmt.Errorf("mpv exited: %w\n%s", err, msg)
+		}
+		return Summary{}, fmt.Errorf("mpv exited: %w", err)
+	}
+	// nothing is tracked here
+	return Summary{}, nil
+}
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.Join(lines[max(len(lines)-n, 0):], "\n")
+}
+
+// mpv lists the devices as 'name' (description)
+var audioDeviceLine = regexp.MustCompile(`^\s*'([^']*)' \((.*)\)$`)
+
+// Audio devices mpv can play to, there's no way to change them while playing here
+func ListAudioDevices() ([]AudioDevice, error) {
+	path, err := exec.LookPath(viper.GetString("mpv_path"))
+	if err != nil {
+		return nil, fmt.Errorf("mpv was not found in PATH (%s), install it or set mpv_path and try again", os.Getenv("PATH"))
+	}
+	out, err := exec.Command(path, "--audio-device=help").Output()
+	if err != nil {
+		return nil, fmt.Errorf("mpv exited: %w", err)
+	}
+	var devices []AudioDevice
+	for _, line := range strings.Split(string(out), "\n") {
+		if match := audioDeviceLine.FindStringSubmatch(line); match != nil {
+			devices = append(devices, AudioDevice{Name: match[1], Description: match[2]})
+		}
+	}
+	return devices, nil
 }
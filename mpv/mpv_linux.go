@@ -10,10 +10,26 @@ package mpv
 import "C"
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 	"unsafe"
 
+	"github.com/google/uuid"
+	"github.com/hacel/jfsh/config"
 	"github.com/hacel/jfsh/jellyfin"
+	"github.com/hacel/jfsh/state"
+	"github.com/sj14/jellyfin-go/api"
+	"github.com/spf13/viper"
 )
 
 func mpv_set_property(mpv_ctx *C.mpv_handle, name string, format C.mpv_format, data []byte) {
@@ -23,23 +39,187 @@ func mpv_set_property(mpv_ctx *C.mpv_handle, name string, format C.mpv_format, d
 	defer C.free(unsafe.Pointer(cdata))
 	status := C.mpv_set_property(mpv_ctx, cname, format, unsafe.Pointer(&cdata))
 	if status < 0 {
-		// NOTE: possibly don't have to panic?
-		panic("err in mpv_set_property")
+		slog.Error("failed to set property", "name", name, "err", C.GoString(C.mpv_error_string(status)))
 	}
 }
 
+func mpv_set_option_string(mpv_ctx *C.mpv_handle, name, value string) error {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	cvalue := C.CString(value)
+	defer C.free(unsafe.Pointer(cvalue))
+	if status := C.mpv_set_option_string(mpv_ctx, cname, cvalue); status < 0 {
+		return errors.New(C.GoString(C.mpv_error_string(status)))
+	}
+	return nil
+}
+
 func mpv_observe_property(mpv_ctx *C.mpv_handle, name string, format C.mpv_format) {
 	n := C.CString(name)
 	defer C.free(unsafe.Pointer(n))
 	status := C.mpv_observe_property(mpv_ctx, 0, n, format)
 	if status < 0 {
-		// NOTE: possibly don't have to panic?
-		panic("err in mpv_observe_property")
+		slog.Error("failed to observe property", "name", name, "err", C.GoString(C.mpv_error_string(status)))
+	}
+}
+
+func mpv_get_property_int64(mpv_ctx *C.mpv_handle, name string) (int64, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	var value C.int64_t
+	if status := C.mpv_get_property(mpv_ctx, cname, C.MPV_FORMAT_INT64, unsafe.Pointer(&value)); status < 0 {
+		return 0, errors.New(C.GoString(C.mpv_error_string(status)))
+	}
+	return int64(value), nil
+}
+
+// Reads a property like track-list or chapter-list into v, mpv hands out structured properties as json
+// when asked for a string. libmpv answers synchronously so there are no replies to match up
+func mpv_get_property_json(mpv_ctx *C.mpv_handle, name string, v any) error {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	cvalue := C.mpv_get_property_string(mpv_ctx, cname)
+	if cvalue == nil {
+		return fmt.Errorf("property %s is not available", name)
+	}
+	defer C.mpv_free(unsafe.Pointer(cvalue))
+	return json.Unmarshal([]byte(C.GoString(cvalue)), v)
+}
+
+func mpv_get_property_string(mpv_ctx *C.mpv_handle, name string) (string, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	cvalue := C.mpv_get_property_string(mpv_ctx, cname)
+	if cvalue == nil {
+		return "", fmt.Errorf("property %s is not available", name)
+	}
+	defer C.mpv_free(unsafe.Pointer(cvalue))
+	return C.GoString(cvalue), nil
+}
+
+// Audio devices mpv can play to, from an instance that doesn't play anything
+func ListAudioDevices() ([]AudioDevice, error) {
+	mpv_ctx := C.mpv_create()
+	if mpv_ctx == nil {
+		return nil, errors.New("failed to create an mpv instance, make sure mpv is installed")
+	}
+	defer C.mpv_terminate_destroy(mpv_ctx)
+	if status := C.mpv_initialize(mpv_ctx); status < 0 {
+		return nil, fmt.Errorf("failed to initialize mpv: %s", C.GoString(C.mpv_error_string(status)))
+	}
+	var devices []AudioDevice
+	if err := mpv_get_property_json(mpv_ctx, "audio-device-list", &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// Switches to the next audio device for the rest of the session
+func cycleAudioDevice(mpv_ctx *C.mpv_handle) {
+	var devices []AudioDevice
+	if err := mpv_get_property_json(mpv_ctx, "audio-device-list", &devices); err != nil {
+		slog.Error("failed to list audio devices", "err", err)
+		return
+	}
+	current, _ := mpv_get_property_string(mpv_ctx, "audio-device")
+	next, ok := nextAudioDevice(devices, current)
+	if !ok {
+		return
+	}
+	if err := mpv_command(mpv_ctx, "set", "audio-device", next.Name); err != nil {
+		slog.Error("failed to set audio device", "device", next.Name, "err", err)
+		return
+	}
+	mpv_command(mpv_ctx, "show-text", "Audio device: "+next.Description, "2000")
+}
+
+// How long before the end of an episode the next one is announced
+const upNextSeconds = 10
+
+// How often osd_info shows the time left
+const osdInfoInterval = 10 * time.Minute
+
+// Progress is reported at least this often while paused
+const keepAliveInterval = 30 * time.Second
+
+// The local position is written at most this often, every write rewrites state.json
+const positionSaveInterval = 10 * time.Second
+
+// The server doesn't mux external subtitles into a direct stream, they're added as separate tracks
+// without selecting them
+func addExternalSubtitles(mpv_ctx *C.mpv_handle, client *jellyfin.Client, item jellyfin.Item) {
+	for _, stream := range jellyfin.GetExternalSubtitleStreams(item) {
+		title := stream.GetDisplayTitle()
+		if title == "" {
+			title = stream.GetTitle()
+		}
+		if err := mpv_command(mpv_ctx, "sub-add", client.GetSubtitleURL(item, stream), "auto", title, stream.GetLanguage()); err != nil {
+			slog.Error("failed to add external subtitle", "index", stream.GetIndex(), "err", err)
+		}
+	}
+}
+
+// Embedded subtitles are picked when the file is loaded, external ones only exist once they're added,
+// so one is selected afterwards if it's preferred over all of the embedded ones
+func selectExternalSubtitle(mpv_ctx *C.mpv_handle, item jellyfin.Item) {
+	streams := getTrackStreams(item, api.MEDIASTREAMTYPE_SUBTITLE)
+	var sid int64
+	var ok bool
+	if tracks, remembered := getSeriesTracks(item); remembered {
+		if tracks.SubtitlesOff || tracks.Subtitle == "" {
+			return
+		}
+		sid, ok = getPreferredSubtitleTrackId(item, []string{tracks.Subtitle}, streams)
+	} else {
+		var audioLang string
+		if aid, err := mpv_get_property_int64(mpv_ctx, "aid"); err == nil {
+			if index, found := getStreamIndex(item, api.MEDIASTREAMTYPE_AUDIO, aid); found {
+				audioLang = getStreamLanguage(item, index)
+			}
+		}
+		sid, ok = getSubtitleTrackId(item, audioLang, streams)
+	}
+	if !ok || sid <= int64(len(jellyfin.GetEmbeddedSubtitleStreams(item))) {
+		return
+	}
+	if err := mpv_command(mpv_ctx, "set", "sid", strconv.FormatInt(sid, 10)); err != nil {
+		slog.Error("failed to select external subtitle", "err", err)
 	}
 }
 
-func mpv_loadfile(mpv_ctx *C.mpv_handle, item jellyfin.Item) {
-	cmd := []string{"loadfile", getUrl(item), "replace", "0", "start=" + strconv.Itoa(int(getResumePosition(item)))}
+// Replaces whatever was selected, external subtitles have to be added already
+func applyPickedTracks(mpv_ctx *C.mpv_handle, item jellyfin.Item, tracks Tracks) {
+	aid, sid := getPickedTrackIds(item, tracks)
+	if aid != "" {
+		if err := mpv_command(mpv_ctx, "set", "aid", aid); err != nil {
+			slog.Error("failed to select picked audio track", "err", err)
+		}
+	}
+	if sid != "" {
+		if err := mpv_command(mpv_ctx, "set", "sid", sid); err != nil {
+			slog.Error("failed to select picked subtitle track", "err", err)
+		}
+	}
+}
+
+// flag is one of mpv's loadfile flags, e.g. replace or append
+func mpv_loadfile(mpv_ctx *C.mpv_handle, item jellyfin.Item, url, flag string, start int64) error {
+	options := "start=" + strconv.FormatInt(start, 10)
+	if aid, ok := getDefaultAudioTrackId(item); ok {
+		options += ",aid=" + strconv.FormatInt(aid, 10)
+	}
+	// fall back to mpv's own selection if nothing matches
+	var audioLang string
+	if len(item.MediaSources) > 0 && item.MediaSources[0].DefaultAudioStreamIndex.Get() != nil {
+		audioLang = getStreamLanguage(item, *item.MediaSources[0].DefaultAudioStreamIndex.Get())
+	}
+	if sid, ok := getSubtitleTrackId(item, audioLang, jellyfin.GetEmbeddedSubtitleStreams(item)); ok {
+		options += ",sid=" + strconv.FormatInt(sid, 10)
+	}
+	return mpv_command(mpv_ctx, "loadfile", edlUrl(url), flag, "-1", options)
+}
+
+func mpv_command(mpv_ctx *C.mpv_handle, cmd ...string) error {
 	ccmd := make([]*C.char, len(cmd)+1)
 	for i := range cmd {
 		ccmd[i] = C.CString(cmd[i])
@@ -47,42 +227,550 @@ func mpv_loadfile(mpv_ctx *C.mpv_handle, item jellyfin.Item) {
 	}
 	status := C.mpv_command(mpv_ctx, (**C.char)(&ccmd[0]))
 	if status < 0 {
-		// NOTE: possibly don't have to panic?
-		panic("err in mpv_loadfile")
+		return errors.New(C.GoString(C.mpv_error_string(status)))
 	}
+	return nil
 }
 
-func Play(client *jellyfin.Client, item jellyfin.Item) {
+// Common install locations of the mpv-mpris plugin, libmpv doesn't load the user's mpv scripts on its own
+func findMprisPlugin() (string, bool) {
+	paths := []string{
+		"/usr/lib/mpv-mpris/mpris.so",
+		"/usr/lib/mpv/mpris.so",
+		"/usr/local/lib/mpv/mpris.so",
+		"/usr/share/mpv/scripts/mpris.so",
+		"/etc/mpv/scripts/mpris.so",
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append([]string{filepath.Join(dir, "mpv", "scripts", "mpris.so")}, paths...)
+	}
+	if path := viper.GetString("mpris_plugin"); path != "" {
+		paths = []string{path}
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+func logMessage(level, prefix, text string) {
+	l := slog.LevelWarn
+	if level == "error" || level == "fatal" {
+		l = slog.LevelError
+	}
+	slog.Log(context.Background(), l, "mpv: "+strings.TrimSpace(text), "module", prefix)
+}
+
+// Plays items[index] starting at start seconds with the rest of items around it in the playlist,
+// blocks until mpv exits. picked are the tracks of items[index], nil to select them as usual.
+// Errors are only returned if playback couldn't start at all.
+func Play(client *jellyfin.Client, items []jellyfin.Item, index int, start int64, picked *Tracks) (Summary, error) {
+	items, index, err := getPlayable(items, index)
+	if err != nil {
+		return Summary{}, err
+	}
+	pickedId := items[index].GetId()
+	if path := viper.GetString("mpv_path"); path != "mpv" {
+		// libmpv is linked in, there's no executable to run
+		slog.Warn("mpv_path is only used on macOS, ignoring it", "mpv_path", path)
+	}
 	mpv_ctx := C.mpv_create()
+	if mpv_ctx == nil {
+		return Summary{}, errors.New("failed to create an mpv instance, make sure mpv is installed")
+	}
 	defer C.mpv_terminate_destroy(mpv_ctx)
 
+	// mpv's own warnings and errors end up in jfsh's log, nothing else shows them
+	clevel := C.CString("warn")
+	defer C.free(unsafe.Pointer(clevel))
+	C.mpv_request_log_messages(mpv_ctx, clevel)
+
 	mpv_set_property(mpv_ctx, "config-dir", C.MPV_FORMAT_STRING, []byte("/Users/sammar/github/jfsh/mpv"))
 	mpv_set_property(mpv_ctx, "config", C.MPV_FORMAT_FLAG, []byte("1"))
 	mpv_set_property(mpv_ctx, "osc", C.MPV_FORMAT_FLAG, []byte("1"))
 	mpv_set_property(mpv_ctx, "input-default-bindings", C.MPV_FORMAT_FLAG, []byte("1"))
 	mpv_set_property(mpv_ctx, "input-vo-keyboard", C.MPV_FORMAT_FLAG, []byte("1"))
-	mpv_set_property(mpv_ctx, "force-media-title", C.MPV_FORMAT_STRING, []byte(getMediaTitle(item)))
+	// libmpv idles forever by default, quit after the last file instead
+	mpv_set_property(mpv_ctx, "idle", C.MPV_FORMAT_STRING, []byte("once"))
+	// for external subtitles that aren't utf-8, mpv guesses otherwise
+	if codepage := viper.GetString("subtitle_codepage"); codepage != "" {
+		mpv_set_option_string(mpv_ctx, "sub-codepage", codepage)
+	}
+	if device := viper.GetString("audio_device"); device != "" {
+		mpv_set_option_string(mpv_ctx, "audio-device", device)
+	}
+	for _, option := range parseMpvArgs(append(getWindowArgs(), viper.GetStringSlice("mpv_args")...)) {
+		if err := mpv_set_option_string(mpv_ctx, option[0], option[1]); err != nil {
+			slog.Error("failed to set option from mpv_args", "option", option[0], "value", option[1], "err", err)
+		}
+	}
 
 	mpv_observe_property(mpv_ctx, "time-pos", C.MPV_FORMAT_INT64)
+	mpv_observe_property(mpv_ctx, "pause", C.MPV_FORMAT_FLAG)
+	mpv_observe_property(mpv_ctx, "aid", C.MPV_FORMAT_INT64)
+	mpv_observe_property(mpv_ctx, "sid", C.MPV_FORMAT_INT64)
+	mpv_observe_property(mpv_ctx, "volume", C.MPV_FORMAT_DOUBLE)
+	mpv_observe_property(mpv_ctx, "speed", C.MPV_FORMAT_DOUBLE)
+	mpv_observe_property(mpv_ctx, "video-aspect-override", C.MPV_FORMAT_DOUBLE)
+	mpv_observe_property(mpv_ctx, "panscan", C.MPV_FORMAT_DOUBLE)
 
-	status := C.mpv_initialize(mpv_ctx)
-	if status < 0 {
-		// NOTE: possibly don't have to panic?
-		panic("err in mpv_initialize")
+	if status := C.mpv_initialize(mpv_ctx); status < 0 {
+		return Summary{}, fmt.Errorf("failed to initialize mpv: %s", C.GoString(C.mpv_error_string(status)))
+	}
+
+	// mpv waits for the hook before unloading a file, so the final position can still be read
+	// and on_load is the last chance to change the tracks of a file, after the options it was loaded with
+	for _, name := range []string{"on_load", "on_unload"} {
+		cname := C.CString(name)
+		defer C.free(unsafe.Pointer(cname))
+		if status := C.mpv_hook_add(mpv_ctx, 0, cname, 0); status < 0 {
+			slog.Error("failed to add hook", "hook", name, "err", C.GoString(C.mpv_error_string(status)))
+		}
+	}
+
+	// media keys and status bars get the title and duration through the plugin, the title is set on start-file
+	if viper.GetBool("mpris") {
+		if path, ok := findMprisPlugin(); ok {
+			if err := mpv_command(mpv_ctx, "load-script", path); err != nil {
+				slog.Error("failed to load mpris plugin", "path", path, "err", err)
+			}
+		} else {
+			slog.Debug("mpris plugin not found")
+		}
+	}
+
+	if viper.GetBool("shuffle") {
+		// the chosen item still plays first, everything else comes after it in random order
+		rest := append(slices.Clone(items[:index]), items[index+1:]...)
+		rand.Shuffle(len(rest), func(i, j int) { rest[i], rest[j] = rest[j], rest[i] })
+		items, index = append([]jellyfin.Item{items[index]}, rest...), 0
+	}
+
+	// mpv hands out playlist entry ids in the order files are loaded, starting at 1
+	entries := map[int64]int{} // entry id to index in items
+	load := func(i int, flag string, start int64) error {
+		url, err := getPlaybackURL(client, items[i])
+		if err != nil {
+			return err
+		}
+		if err := mpv_loadfile(mpv_ctx, items[i], url, flag, start); err != nil {
+			return err
+		}
+		entries[int64(len(entries)+1)] = i
+		return nil
+	}
+	if err := load(index, "replace", start); err != nil {
+		return Summary{}, fmt.Errorf("failed to load file: %w", err)
+	}
+	// only a window of items around the current one is loaded, it's extended as playback nears either end.
+	// Every file needs a request to the server, so they're loaded one per turn of the event loop and
+	// quitting mpv while the window is still filling doesn't wait for the rest of them
+	window := max(viper.GetInt("playlist_window"), 1)
+	lo, hi := index, index+1 // loaded range of items
+	around := index          // the window is filled around this item
+	filling := true
+	// Loads the next item of the window, false once it's full
+	extend := func() bool {
+		if hi < len(items) && hi <= around+window {
+			if err := load(hi, "append", 0); err != nil {
+				slog.Error("failed to append file", "err", err)
+			}
+			hi++
+			return true
+		}
+		// prepend by appending and moving to the front, closest first so they end up in order
+		if lo > 0 && lo > around-window {
+			lo--
+			if err := load(lo, "append", 0); err != nil {
+				slog.Error("failed to prepend file", "err", err)
+				return true
+			}
+			if err := mpv_command(mpv_ctx, "playlist-move", strconv.Itoa(len(entries)-1), "0"); err != nil {
+				slog.Error("failed to prepend file", "err", err)
+			}
+			return true
+		}
+		return false
 	}
 
-	mpv_loadfile(mpv_ctx, item)
+	switch viper.GetString("repeat") {
+	case "all":
+		mpv_set_property(mpv_ctx, "loop-playlist", C.MPV_FORMAT_STRING, []byte("inf"))
+	case "one":
+		mpv_set_property(mpv_ctx, "loop-file", C.MPV_FORMAT_STRING, []byte("inf"))
+	}
+
+	osdInfo := viper.GetBool("osd_info")
+	autoplay := viper.GetBool("autoplay_next")
+	if !autoplay {
+		// stay at the end of every file, the next one is only played when asked for
+		mpv_set_property(mpv_ctx, "keep-open", C.MPV_FORMAT_STRING, []byte("always"))
+	} else if err := mpv_command(mpv_ctx, "define-section", "jfsh-next", "n script-message jfsh-cancel-next", "force"); err != nil {
+		slog.Error("failed to bind cancel autoplay key", "err", err)
+	}
+
+	// PGUP and PGDWN already jump between chapters, C lists them
+	if err := mpv_command(mpv_ctx, "define-section", "jfsh-chapters", "C script-message jfsh-chapters", "force"); err != nil {
+		slog.Error("failed to bind chapter list key", "err", err)
+	} else {
+		mpv_command(mpv_ctx, "enable-section", "jfsh-chapters")
+	}
+	// the device picked with D only lasts until mpv quits, audio_device is the default
+	if err := mpv_command(mpv_ctx, "define-section", "jfsh-audio", "D script-message jfsh-audio-device", "force"); err != nil {
+		slog.Error("failed to bind audio device key", "err", err)
+	} else {
+		mpv_command(mpv_ctx, "enable-section", "jfsh-audio")
+	}
 
 	// TODO: should this communicate back to the main thread through a channel or something?
-	var progress int64
+	skipMode := viper.GetString("skip_mode")
+	if skipMode == "prompt" {
+		// only enabled while inside a segment so the key keeps its default binding otherwise
+		if err := mpv_command(mpv_ctx, "define-section", "jfsh-skip", "s script-message jfsh-skip", "force"); err != nil {
+			slog.Error("failed to bind skip key", "err", err)
+		}
+	}
+	skipSeek := false // the next seek event is from skip, not the user
+	skip := func(s segment) {
+		skipSeek = true
+		if err := mpv_command(mpv_ctx, "seek", strconv.FormatFloat(s.end, 'f', -1, 64), "absolute"); err != nil {
+			slog.Error("failed to skip segment", "name", s.name, "err", err)
+		}
+	}
+	interval := time.Duration(viper.GetInt("progress_interval_seconds")) * time.Second
+	presence := connectPresence()
+	defer presence.Close()
+	// commands arrive on another goroutine, the client api is thread safe
+	remote := connectRemote(client, func(cmd jellyfin.RemoteCommand) {
+		var err error
+		switch cmd.Command {
+		case "Pause":
+			err = mpv_command(mpv_ctx, "set", "pause", "yes")
+		case "Unpause":
+			err = mpv_command(mpv_ctx, "set", "pause", "no")
+		case "PlayPause":
+			err = mpv_command(mpv_ctx, "cycle", "pause")
+		case "Seek":
+			err = mpv_command(mpv_ctx, "seek", strconv.FormatInt(cmd.SeekPositionTicks/10000000, 10), "absolute")
+		case "Stop":
+			err = mpv_command(mpv_ctx, "quit")
+		case "NextTrack":
+			err = mpv_command(mpv_ctx, "playlist-next")
+		case "PreviousTrack":
+			err = mpv_command(mpv_ctx, "playlist-prev")
+		default:
+			slog.Debug("unsupported remote command", "command", cmd.Command)
+			return
+		}
+		if err != nil {
+			slog.Error("failed to run remote command", "command", cmd.Command, "err", err)
+		}
+	})
+	defer remote.Close()
+	scrobbler := newTrakt()
+	// one for everything played until mpv quits
+	playSession := uuid.NewString()
+
+	// state of the file that's currently playing, reset on every start-file
+	var (
+		crop, appliedCrop state.Crop   // aspect and panscan, saved for the item when changed
+		appliedTracks     state.Tracks // tracks once the file loaded, changing them sets the series default
+		item              *jellyfin.Item
+		playState         jellyfin.PlayState
+		lastReport        time.Time
+		lastSaved         time.Time // last time the local position was written
+		unreachable       bool      // the last progress report failed, only the first failure is logged
+		seasonRest        int64     // seconds of the rest of the season after this file
+		infoShown         time.Time // last time osd_info showed, zero until it did on this file
+		skippableSegments []segment
+		chapters          []chapter // of the current file, as mpv sees them
+		prompted          *segment  // segment the skip prompt is currently shown for
+		userSeek          bool      // a seek the user made is in progress
+		unskipped         *segment  // the user seeked into this segment, it's left alone until playback leaves it
+		upNext            *jellyfin.Item
+		countingDown      bool // the up next countdown is shown and its cancel key is bound
+		autoplayCanceled  bool
+		appliedVolume     float64 // volume at start-file, only changes from it are saved
+	)
+	volume := -1.0 // current mpv volume, negative until mpv reports it
+	speed := viper.GetFloat64("playback_speed")
+	marked := map[string]bool{} // items marked played in this session, seeking back and finishing again doesn't re-mark
+	var summary Summary
+	// state changes are reported right away, time-pos ticks are debounced
+	report := func(force bool) {
+		if item == nil || (!force && time.Since(lastReport) < interval) {
+			return
+		}
+		err := client.ReportPlaybackProgress(*item, playState)
+		// failures wait for the interval too, every attempt blocks while it's retried
+		lastReport = time.Now()
+		if err != nil {
+			if !unreachable {
+				// the local position keeps being saved, reporting picks up again once the server is back
+				slog.Error("failed to report playback progress", "err", err)
+				unreachable = true
+			}
+			return
+		}
+		if unreachable {
+			slog.Info("reporting playback progress again")
+			unreachable = false
+		}
+	}
+	reportStopped := func(item jellyfin.Item) {
+		err := client.ReportPlaybackStopped(item, playState)
+		if err != nil {
+			slog.Error("failed to report playback stopped", "err", err)
+			// the server doesn't have it, keep the last position locally
+			if err := savePosition(item.GetId(), playState.Position); err != nil {
+				slog.Error("failed to save local position", "err", err)
+			}
+		} else if err := clearPosition(item.GetId()); err != nil {
+			slog.Error("failed to clear local position", "err", err)
+		}
+		summary.Items++
+		summary.Title, summary.Reported, summary.Played = getMediaTitle(item), err == nil, false
+		if item.GetType() == api.BASEITEMKIND_EPISODE {
+			if err := saveLastEpisode(item); err != nil {
+				slog.Error("failed to save last episode", "err", err)
+			}
+		}
+		if speed != viper.GetFloat64("playback_speed") {
+			// the last speed used becomes the default
+			if err := config.Save(map[string]any{"playback_speed": speed}); err != nil {
+				slog.Error("failed to save playback speed", "err", err)
+			}
+		}
+		if volume >= 0 && volume != appliedVolume {
+			if err := saveVolume(item.GetId(), volume); err != nil {
+				slog.Error("failed to save volume", "err", err)
+			}
+		}
+		// no audio track means the file never loaded
+		if tracks := getTracks(item, playState.AudioStreamIndex, playState.SubtitleStreamIndex); playState.AudioStreamIndex != nil && tracks != appliedTracks {
+			if err := saveSeriesTracks(item, tracks); err != nil {
+				slog.Error("failed to save series tracks", "err", err)
+			}
+		}
+		if crop != appliedCrop {
+			if err := saveCrop(item.GetId(), crop); err != nil {
+				slog.Error("failed to save aspect and panscan", "err", err)
+			}
+		}
+		if isWatched(item, playState.Position) && !marked[item.GetId()] {
+			marked[item.GetId()] = true
+			if err := client.MarkPlayed(item); err != nil {
+				slog.Error("failed to mark item played", "err", err)
+			} else {
+				summary.Played = true
+			}
+		}
+		if item.GetType() == api.BASEITEMKIND_EPISODE {
+			// the next episode is up now
+			client.InvalidateSeries(item.GetSeriesId())
+		}
+		presence.Clear()
+		scrobble(scrobbler, "stop", item, playState.Position)
+	}
+	stop := func() { stopFile(&item, reportStopped) }
+	// however the loop is left the server shouldn't be left thinking something is still playing,
+	// stop does nothing if end-file already reported it
+	defer stop()
 	for {
-		e := C.mpv_wait_event(mpv_ctx, 1)
+		if filling {
+			filling = extend()
+		}
+		timeout := 1.0
+		if filling {
+			// only waits for events that are already there
+			timeout = 0
+		}
+		e := C.mpv_wait_event(mpv_ctx, C.double(timeout))
 		switch e.event_id {
-		case C.MPV_EVENT_SHUTDOWN, C.MPV_EVENT_END_FILE:
-			client.ReportPlaybackStopped(item, progress)
-			return
+		case C.MPV_EVENT_NONE:
+			// nothing changes while paused, the server would drop the session without hearing from it
+			if item != nil && playState.Paused && time.Since(lastReport) >= keepAliveInterval {
+				report(true)
+			}
+		case C.MPV_EVENT_LOG_MESSAGE:
+			msg := (*C.mpv_event_log_message)(e.data)
+			logMessage(C.GoString(msg.level), C.GoString(msg.prefix), C.GoString(msg.text))
+		case C.MPV_EVENT_SHUTDOWN:
+			stop()
+			return summary, nil
+		case C.MPV_EVENT_START_FILE:
+			stop() // in case end-file went missing
+			id := int64((*C.mpv_event_start_file)(e.data).playlist_entry_id)
+			current, ok := entries[id]
+			if !ok {
+				slog.Error("unknown playlist entry", "id", id)
+				continue
+			}
+			next := items[current]
+			item = &next
+			if current-lo < 2 || hi-current <= 2 {
+				around, filling = current, true
+			}
+			playState = jellyfin.PlayState{PlaySessionId: playSession}
+			if id == 1 {
+				playState.Position = start
+			}
+			lastReport, lastSaved = time.Time{}, time.Time{}
+			skippableSegments = nil
+			if skipMode != "off" {
+				skippableSegments = getSkippableSegments(*item, getSkipPatterns())
+			}
+			if prompted != nil {
+				prompted = nil
+				mpv_command(mpv_ctx, "disable-section", "jfsh-skip")
+			}
+			userSeek, unskipped = false, nil
+			seasonRest, infoShown = getSeasonRest(items, current), time.Time{}
+			upNext = nil
+			// the window is usually still filling when the first file starts, the next one is loaded soon enough
+			if current+1 < len(items) && viper.GetString("repeat") != "one" {
+				upNext = &items[current+1]
+			}
+			if countingDown {
+				countingDown = false
+				mpv_command(mpv_ctx, "disable-section", "jfsh-next")
+			}
+			autoplayCanceled = false
+			mpv_set_property(mpv_ctx, "force-media-title", C.MPV_FORMAT_STRING, []byte(getMediaTitle(*item)))
+			if err := mpv_command(mpv_ctx, "set", "speed", strconv.FormatFloat(viper.GetFloat64("playback_speed"), 'f', -1, 64)); err != nil {
+				slog.Error("failed to set playback speed", "err", err)
+			}
+			appliedVolume = volume
+			if v, ok := getSavedVolume(item.GetId()); ok {
+				appliedVolume = v
+				if err := mpv_command(mpv_ctx, "set", "volume", strconv.FormatFloat(v, 'f', -1, 64)); err != nil {
+					slog.Error("failed to restore volume", "err", err)
+				}
+			}
+			appliedCrop = getCrop(item.GetId())
+			crop = appliedCrop
+			if err := mpv_command(mpv_ctx, "set", "video-aspect-override", strconv.FormatFloat(crop.Aspect, 'f', -1, 64)); err != nil {
+				slog.Error("failed to set aspect override", "err", err)
+			}
+			if err := mpv_command(mpv_ctx, "set", "panscan", strconv.FormatFloat(crop.Panscan, 'f', -1, 64)); err != nil {
+				slog.Error("failed to set panscan", "err", err)
+			}
+			if err := client.ReportPlaybackStart(*item, playState); err != nil {
+				slog.Error("failed to report playback start", "err", err)
+			}
+			updatePresence(presence, *item, playState)
+			scrobble(scrobbler, "start", *item, playState.Position)
+		case C.MPV_EVENT_HOOK:
+			hook := (*C.mpv_event_hook)(e.data)
+			if C.GoString(hook.name) == "on_load" && item != nil {
+				for _, option := range getToneMappingOptions(*item) {
+					if err := mpv_command(mpv_ctx, "set", "file-local-options/"+option[0], option[1]); err != nil {
+						slog.Error("failed to set tone mapping option", "option", option[0], "err", err)
+					}
+				}
+				if tracks, ok := getSeriesTracks(*item); ok {
+					if aid, ok := getTrackIdByLanguage(*item, api.MEDIASTREAMTYPE_AUDIO, tracks.Audio); ok {
+						mpv_command(mpv_ctx, "set", "file-local-options/aid", strconv.FormatInt(aid, 10))
+					}
+					if tracks.SubtitlesOff {
+						mpv_command(mpv_ctx, "set", "file-local-options/sid", "no")
+					} else if sid, ok := getTrackIdByLanguage(*item, api.MEDIASTREAMTYPE_SUBTITLE, tracks.Subtitle); ok {
+						mpv_command(mpv_ctx, "set", "file-local-options/sid", strconv.FormatInt(sid, 10))
+					}
+				}
+			}
+			if C.GoString(hook.name) == "on_unload" && item != nil {
+				// time-pos is only observed once a second and the last change might not have arrived yet
+				if pos, err := mpv_get_property_int64(mpv_ctx, "time-pos"); err == nil {
+					playState.Position = pos
+				}
+			}
+			C.mpv_hook_continue(mpv_ctx, hook.id)
+		case C.MPV_EVENT_FILE_LOADED:
+			if item == nil {
+				continue
+			}
+			addExternalSubtitles(mpv_ctx, client, *item)
+			if picked != nil && item.GetId() == pickedId {
+				applyPickedTracks(mpv_ctx, *item, *picked)
+			} else {
+				selectExternalSubtitle(mpv_ctx, *item)
+			}
+			// what got selected before the user touched anything
+			var audio, subtitle *int32
+			if aid, err := mpv_get_property_int64(mpv_ctx, "aid"); err == nil {
+				if index, ok := getStreamIndex(*item, api.MEDIASTREAMTYPE_AUDIO, aid); ok {
+					audio = &index
+				}
+			}
+			off := int32(-1)
+			subtitle = &off
+			if sid, err := mpv_get_property_int64(mpv_ctx, "sid"); err == nil {
+				if index, ok := getStreamIndex(*item, api.MEDIASTREAMTYPE_SUBTITLE, sid); ok {
+					subtitle = &index
+				}
+			}
+			appliedTracks = getTracks(*item, audio, subtitle)
+			if picked != nil && item.GetId() == pickedId {
+				// nothing counts as applied so the picked tracks are remembered for the series like any other change,
+				// and they're only picked the first time the file loads
+				appliedTracks = state.Tracks{}
+				picked = nil
+			}
+			chapters = nil
+			if err := mpv_get_property_json(mpv_ctx, "chapter-list", &chapters); err != nil {
+				slog.Debug("no chapters", "err", err)
+			}
+			for _, c := range chapters {
+				slog.Debug("chapter", "title", c.Title, "time", c.Time)
+			}
+		case C.MPV_EVENT_SEEK:
+			userSeek = !skipSeek
+			skipSeek = false
+		case C.MPV_EVENT_PLAYBACK_RESTART:
+			// the seek is done so time-pos is where it landed
+			if !userSeek || item == nil {
+				continue
+			}
+			userSeek = false
+			if pos, err := mpv_get_property_int64(mpv_ctx, "time-pos"); err == nil {
+				if segment, inside := isInsideSkippableSegment(skippableSegments, pos); inside {
+					unskipped = &segment
+				}
+			}
+		case C.MPV_EVENT_END_FILE:
+			stop()
+		case C.MPV_EVENT_CLIENT_MESSAGE:
+			msg := (*C.mpv_event_client_message)(e.data)
+			args := unsafe.Slice(msg.args, int(msg.num_args))
+			if len(args) > 0 && C.GoString(args[0]) == "jfsh-skip" && prompted != nil {
+				skip(*prompted)
+			}
+			if len(args) > 0 && C.GoString(args[0]) == "jfsh-chapters" {
+				current, _ := mpv_get_property_int64(mpv_ctx, "chapter")
+				text := formatChapters(chapters, current, skippableSegments)
+				if text == "" {
+					text = "No chapters"
+				}
+				mpv_command(mpv_ctx, "show-text", text, "5000")
+			}
+			if len(args) > 0 && C.GoString(args[0]) == "jfsh-audio-device" {
+				cycleAudioDevice(mpv_ctx)
+			}
+			if len(args) > 0 && C.GoString(args[0]) == "jfsh-cancel-next" && countingDown {
+				countingDown = false
+				autoplayCanceled = true
+				mpv_command(mpv_ctx, "disable-section", "jfsh-next")
+				mpv_command(mpv_ctx, "set", "file-local-options/keep-open", "always")
+				mpv_command(mpv_ctx, "show-text", "Autoplay canceled", "2000")
+			}
 		// TODO: report progress immediately on seek?
 		case C.MPV_EVENT_PROPERTY_CHANGE:
+			if item == nil {
+				continue
+			}
 			data := (*C.mpv_event_property)(e.data)
 			data_name := C.GoString(data.name)
 			switch data_name {
@@ -91,8 +779,117 @@ func Play(client *jellyfin.Client, item jellyfin.Item) {
 				if pos == nil {
 					continue
 				}
-				progress = *pos
-				client.ReportPlaybackProgress(item, progress)
+				if *pos == playState.Position {
+					continue
+				}
+				// time-pos moves a second at a time while playing, anything else is a seek
+				if d := *pos - playState.Position; d > 0 && d <= 2 {
+					summary.Watched += d
+				}
+				playState.Position = *pos
+				if time.Since(lastSaved) >= positionSaveInterval {
+					if err := savePosition(item.GetId(), playState.Position); err != nil {
+						slog.Error("failed to save local position", "err", err)
+					}
+					lastSaved = time.Now()
+				}
+				report(false)
+				segment, inside := isInsideSkippableSegment(skippableSegments, playState.Position)
+				switch {
+				case inside && (userSeek || unskipped != nil && *unskipped == segment):
+					// seeked into it on purpose, or still seeking and might be about to
+				case !inside:
+					unskipped = nil
+					if prompted != nil {
+						prompted = nil
+						mpv_command(mpv_ctx, "disable-section", "jfsh-skip")
+					}
+				case skipMode == "prompt":
+					if prompted == nil || *prompted != segment {
+						prompted = &segment
+						mpv_command(mpv_ctx, "show-text", "Press s to skip "+strings.ToLower(segment.name), "5000")
+						mpv_command(mpv_ctx, "enable-section", "jfsh-skip")
+					}
+				default:
+					skip(segment)
+				}
+				if osdInfo && prompted == nil && !countingDown && time.Since(infoShown) >= osdInfoInterval {
+					mpv_command(mpv_ctx, "show-text", formatInfo(*item, playState.Position, seasonRest, infoShown.IsZero()), "4000")
+					infoShown = time.Now()
+				}
+				if !autoplay || autoplayCanceled || upNext == nil {
+					continue
+				}
+				remaining, err := mpv_get_property_int64(mpv_ctx, "time-remaining")
+				switch {
+				case err == nil && remaining <= upNextSeconds:
+					if !countingDown {
+						countingDown = true
+						mpv_command(mpv_ctx, "enable-section", "jfsh-next")
+					}
+					mpv_command(mpv_ctx, "show-text", fmt.Sprintf("Up next: %s, playing in %ds, press n to cancel", getMediaTitle(*upNext), remaining), "1500")
+				case countingDown:
+					// seeked back
+					countingDown = false
+					mpv_command(mpv_ctx, "disable-section", "jfsh-next")
+				}
+			case "pause":
+				flag := (*C.int)(data.data)
+				if flag == nil {
+					continue
+				}
+				// only report actual transitions
+				if paused := *flag != 0; paused != playState.Paused {
+					playState.Paused = paused
+					report(true)
+					updatePresence(presence, *item, playState)
+					if paused {
+						scrobble(scrobbler, "pause", *item, playState.Position)
+					} else {
+						scrobble(scrobbler, "start", *item, playState.Position)
+					}
+				}
+			case "aid":
+				aid := (*int64)(data.data)
+				if aid == nil { // audio disabled
+					continue
+				}
+				index, ok := getStreamIndex(*item, api.MEDIASTREAMTYPE_AUDIO, *aid)
+				if !ok || (playState.AudioStreamIndex != nil && *playState.AudioStreamIndex == index) {
+					continue
+				}
+				playState.AudioStreamIndex = &index
+				report(true)
+			case "sid":
+				index := int32(-1) // subtitles off
+				if sid := (*int64)(data.data); sid != nil {
+					var ok bool
+					index, ok = getStreamIndex(*item, api.MEDIASTREAMTYPE_SUBTITLE, *sid)
+					if !ok { // external track mpv found by itself, the server doesn't know about it
+						continue
+					}
+				}
+				if playState.SubtitleStreamIndex != nil && *playState.SubtitleStreamIndex == index {
+					continue
+				}
+				playState.SubtitleStreamIndex = &index
+				report(true)
+			case "volume":
+				if v := (*float64)(data.data); v != nil {
+					volume = *v
+				}
+			case "video-aspect-override":
+				if v := (*float64)(data.data); v != nil {
+					crop.Aspect = *v
+				}
+			case "panscan":
+				if v := (*float64)(data.data); v != nil {
+					crop.Panscan = *v
+				}
+			case "speed":
+				if v := (*float64)(data.data); v != nil {
+					speed = *v
+				}
 			}
 		}
 	}
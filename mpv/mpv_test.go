@@ -0,0 +1,49 @@
+package mpv
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/hacel/jfsh/jellyfin"
+)
+
+// Plays ids like Play's event loop does, fail stops the loop in the middle of the last file
+func simulatePlay(ids []string, fail bool) (stopped []string) {
+	var item *jellyfin.Item
+	stop := func() {
+		stopFile(&item, func(item jellyfin.Item) { stopped = append(stopped, *item.Id) })
+	}
+	defer func() { recover() }()
+	defer stop()
+	for n, id := range ids {
+		stop() // start-file
+		item = &jellyfin.Item{Id: &id}
+		if fail && n == len(ids)-1 {
+			panic("event loop failed")
+		}
+		stop() // end-file
+	}
+	stop() // shutdown
+	return stopped
+}
+
+func TestStopFile(t *testing.T) {
+	tests := []struct {
+		name string
+		ids  []string
+		fail bool
+	}{
+		{"ends normally", []string{"a"}, false},
+		{"ends normally after a few files", []string{"a", "b", "c"}, false},
+		{"fails mid-stream", []string{"a"}, true},
+		{"fails mid-stream after a few files", []string{"a", "b", "c"}, true},
+		{"nothing played", nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := simulatePlay(test.ids, test.fail); !slices.Equal(got, test.ids) {
+				t.Errorf("stopped %v, want each file once: %v", got, test.ids)
+			}
+		})
+	}
+}
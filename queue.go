@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/hacel/jfsh/jellyfin"
+	"github.com/hacel/jfsh/mpv"
+)
+
+// Items added one by one from any tab, played together in this order instead of the order of a list
+type playQueue struct {
+	items  []item
+	cursor int
+	open   bool // the queue is shown instead of the tabs
+}
+
+func (q *playQueue) index(i item) int {
+	return slices.IndexFunc(q.items, func(queued item) bool { return *queued.Id == *i.Id })
+}
+
+// Adds the highlighted item, or takes it out again if it's already there
+func (m model) toggleQueued() (tea.Model, tea.Cmd) {
+	selected, ok := m.list.SelectedItem().(item)
+	if !ok || selected.isFolder() {
+		return m, m.list.NewStatusMessage("Only movies and episodes can be queued")
+	}
+	q := m.playQueue
+	if n := q.index(selected); n >= 0 {
+		q.items = slices.Delete(q.items, n, n+1)
+		return m, m.list.NewStatusMessage(fmt.Sprintf("Removed from the queue, %d left", len(q.items)))
+	}
+	q.items = append(q.items, selected)
+	return m, m.list.NewStatusMessage(fmt.Sprintf("Queued %s, %d in the queue", selected.Title(), len(q.items)))
+}
+
+func (m model) openQueue() (tea.Model, tea.Cmd) {
+	if len(m.playQueue.items) == 0 {
+		return m, m.list.NewStatusMessage("The queue is empty, add to it with " + m.keys.Enqueue.Help().Key)
+	}
+	m.playQueue.open = true
+	m.playQueue.cursor = min(m.playQueue.cursor, len(m.playQueue.items)-1)
+	return m, nil
+}
+
+func (m model) updateQueue(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	q := m.playQueue
+	switch {
+	case msg.String() == "ctrl+c":
+		return m, tea.Quit
+	case key.Matches(msg, m.keys.QueueClose):
+		q.open = false
+	case key.Matches(msg, m.keys.QueueMoveUp):
+		if q.cursor > 0 {
+			q.items[q.cursor-1], q.items[q.cursor] = q.items[q.cursor], q.items[q.cursor-1]
+			q.cursor--
+		}
+	case key.Matches(msg, m.keys.QueueMoveDown):
+		if q.cursor < len(q.items)-1 {
+			q.items[q.cursor+1], q.items[q.cursor] = q.items[q.cursor], q.items[q.cursor+1]
+			q.cursor++
+		}
+	case key.Matches(msg, m.keys.QueueRemove):
+		q.items = slices.Delete(q.items, q.cursor, q.cursor+1)
+		q.cursor = max(min(q.cursor, len(q.items)-1), 0)
+		q.open = len(q.items) > 0
+	case key.Matches(msg, m.keys.QueueClear):
+		q.items, q.cursor, q.open = nil, 0, false
+	case key.Matches(msg, m.keys.QueuePlay):
+		return m.playQueued()
+	case key.Matches(msg, m.keys.Up):
+		q.cursor = max(q.cursor-1, 0)
+	case key.Matches(msg, m.keys.Down):
+		q.cursor = min(q.cursor+1, len(q.items)-1)
+	}
+	return m, nil
+}
+
+// Everything in the queue with the highlighted one first up, the queue is emptied for the next one
+func (m model) playQueued() (tea.Model, tea.Cmd) {
+	q := m.playQueue
+	items := make([]jellyfin.Item, len(q.items))
+	for n, i := range q.items {
+		items[n] = jellyfin.Item(i)
+	}
+	index := q.cursor
+	m.playing = &q.items[index]
+	q.items, q.cursor, q.open = nil, 0, false
+	spin := m.spin()
+	return m, tea.Batch(spin, func() tea.Msg {
+		summary, err := mpv.Play(m.client, items, index, mpv.GetResumeStart(items[index]), nil)
+		return playbackStopped{summary, err}
+	})
+}
+
+func (q *playQueue) View(keys keyMap) string {
+	doc := strings.Builder{}
+	doc.WriteString("Queue\n\n")
+	for n, i := range q.items {
+		cursor := "  "
+		if n == q.cursor {
+			cursor = "> "
+		}
+		fmt.Fprintf(&doc, "%s%d. %s\n", cursor, n+1, i.Title())
+	}
+	var hints []string
+	for _, b := range []key.Binding{keys.QueuePlay, keys.QueueMoveUp, keys.QueueMoveDown, keys.QueueRemove, keys.QueueClear, keys.QueueClose} {
+		hints = append(hints, fmt.Sprintf("(%s) %s", b.Help().Key, b.Help().Desc))
+	}
+	doc.WriteString("\n" + strings.Join(hints, " "))
+	return doc.String()
+}
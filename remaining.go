@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sj14/jellyfin-go/api"
+)
+
+type remainingLoaded struct {
+	seriesId  string
+	remaining string
+}
+
+// Series the remaining runtime is shown for, a series itself or the episode of a series on Next Up
+func (m model) remainingSeriesId() (string, bool) {
+	selected, ok := m.list.SelectedItem().(item)
+	if !ok || selected.Type == nil {
+		return "", false
+	}
+	switch {
+	case *selected.Type == api.BASEITEMKIND_SERIES && selected.Id != nil:
+		return *selected.Id, true
+	case *selected.Type == api.BASEITEMKIND_EPISODE && m.tabs[m.activeTab] == "Next Up" && selected.SeriesId.Get() != nil:
+		return *selected.SeriesId.Get(), true
+	}
+	return "", false
+}
+
+// Starts totaling the runtime of the selected series unless it's already known or loading
+func (m model) fetchRemaining() tea.Cmd {
+	seriesId, ok := m.remainingSeriesId()
+	if !ok {
+		return nil
+	}
+	if _, ok := m.remaining[seriesId]; ok {
+		return nil
+	}
+	m.remaining[seriesId] = ""
+	return func() tea.Msg {
+		secs, episodes, err := m.client.GetRemainingRuntime(seriesId)
+		if err != nil || episodes == 0 {
+			return remainingLoaded{seriesId: seriesId}
+		}
+		return remainingLoaded{seriesId, fmt.Sprintf("%s left in %d episodes", formatRuntime(secs), episodes)}
+	}
+}
+
+func (m model) selectedRemaining() string {
+	if seriesId, ok := m.remainingSeriesId(); ok {
+		return m.remaining[seriesId]
+	}
+	return ""
+}
+
+// 9h 12m
+func formatRuntime(secs int64) string {
+	h, m := secs/3600, secs/60%60
+	if h > 0 {
+		return fmt.Sprintf("%dh %dm", h, m)
+	}
+	return fmt.Sprintf("%dm", m)
+}
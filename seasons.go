@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/hacel/jfsh/jellyfin"
+	"github.com/sj14/jellyfin-go/api"
+)
+
+// Header of a season in a series, its episodes are listed under it while it's expanded
+type seasonHeader struct {
+	season   item
+	expanded bool
+	episodes []item
+}
+
+func (h seasonHeader) Title() string {
+	arrow := "▸"
+	if h.expanded {
+		arrow = "▾"
+	}
+	return arrow + " " + h.season.Title()
+}
+
+func (h seasonHeader) Description() string {
+	return fmt.Sprintf("%d/%d episodes watched", h.watched(), len(h.episodes))
+}
+
+func (h seasonHeader) watched() int {
+	n := 0
+	for _, e := range h.episodes {
+		if e.played() {
+			n++
+		}
+	}
+	return n
+}
+
+func (h seasonHeader) FilterValue() string { return h.season.FilterValue() }
+
+// Series are shown grouped by season instead of opening every season on its own, unless a filter applies
+func (m model) inSeries() bool {
+	if m.tabs[m.activeTab] != "Library" || len(m.parents) == 0 || m.parents[len(m.parents)-1].extras || m.filter != (jellyfin.Filter{}) {
+		return false
+	}
+	parent := jellyfin.Item(m.parents[len(m.parents)-1].parent)
+	return parent.GetType() == api.BASEITEMKIND_SERIES
+}
+
+// Seasons followed by every episode of the series
+func (m model) getSeriesItems(series jellyfin.Item) ([]jellyfin.Item, error) {
+	seasons, err := m.client.GetSeasons(series)
+	if err != nil {
+		return nil, err
+	}
+	episodes, err := m.client.GetSeriesEpisodes(series.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return append(seasons, episodes...), nil
+}
+
+// Headers for the seasons with the episodes of expanded ones under them, a series with a single season
+// starts expanded. Episodes that aren't in any of the seasons go at the end
+func (m model) groupSeasons(items []jellyfin.Item) []list.Item {
+	var seasons []jellyfin.Item
+	bySeason := map[string][]item{}
+	for _, i := range items {
+		if i.GetType() == api.BASEITEMKIND_SEASON {
+			seasons = append(seasons, i)
+		} else {
+			bySeason[i.GetSeasonId()] = append(bySeason[i.GetSeasonId()], item(i))
+		}
+	}
+	var grouped []list.Item
+	for _, season := range seasons {
+		expanded, ok := m.expanded[season.GetId()]
+		if !ok {
+			expanded = len(seasons) == 1
+		}
+		episodes := bySeason[season.GetId()]
+		delete(bySeason, season.GetId())
+		grouped = append(grouped, seasonHeader{item(season), expanded, episodes})
+		if expanded {
+			for _, e := range episodes {
+				grouped = append(grouped, e)
+			}
+		}
+	}
+	for _, i := range items {
+		if i.GetType() != api.BASEITEMKIND_SEASON && bySeason[i.GetSeasonId()] != nil {
+			grouped = append(grouped, item(i))
+		}
+	}
+	return grouped
+}
+
+// Expands or collapses the season and keeps its header selected
+func (m model) toggleSeason(h seasonHeader) (tea.Model, tea.Cmd) {
+	m.expanded[*h.season.Id] = !h.expanded
+	m.restored = m.list.Index()
+	return m, m.setItems(m.tabCache["Library"])
+}
+
+type seasonMarked struct{}
+
+// Marks every episode of the season watched, or unwatched if they all are already.
+// The server marks the episodes of a season itself
+func (m model) markSeason(h seasonHeader) (tea.Model, tea.Cmd) {
+	played := h.watched() < len(h.episodes)
+	season := jellyfin.Item(h.season)
+	return m, func() tea.Msg {
+		mark := m.client.MarkPlayed
+		if !played {
+			mark = m.client.MarkUnplayed
+		}
+		if err := mark(season); err != nil {
+			return err
+		}
+		return seasonMarked{}
+	}
+}
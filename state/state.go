@@ -0,0 +1,115 @@
+// Small local state that isn't configuration, e.g. the last volume, kept in the xdg state dir
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"maps"
+	"os"
+	"sync"
+
+	"github.com/adrg/xdg"
+)
+
+type State struct {
+	Volume     *float64           `json:"volume,omitempty"`      // last volume, nil to use mpv's
+	ItemVolume map[string]float64 `json:"item_volume,omitempty"` // volume overrides by item id
+	// last position in seconds by item id while it's playing, left behind if jfsh or mpv crash
+	Positions map[string]int64 `json:"positions,omitempty"`
+	ItemCrop  map[string]Crop  `json:"item_crop,omitempty"` // aspect and panscan overrides by item id
+	// track languages by series id, used for every episode of the series
+	SeriesTracks map[string]Tracks `json:"series_tracks,omitempty"`
+	Downloads    map[string]string `json:"downloads,omitempty"`    // local file by item id, played instead of streaming
+	LastEpisode  *Episode          `json:"last_episode,omitempty"` // playing when playback last stopped
+}
+
+type Episode struct {
+	SeriesId  string `json:"series_id"`
+	EpisodeId string `json:"episode_id"`
+}
+
+type Tracks struct {
+	Audio        string `json:"audio,omitempty"`    // language
+	Subtitle     string `json:"subtitle,omitempty"` // language
+	SubtitlesOff bool   `json:"subtitles_off,omitempty"`
+}
+
+type Crop struct {
+	Aspect  float64 `json:"aspect"` // mpv's video-aspect-override, -1 for the file's own aspect
+	Panscan float64 `json:"panscan"`
+}
+
+var (
+	mu      sync.Mutex
+	current State
+	loaded  bool
+)
+
+func path() (string, error) {
+	return xdg.StateFile("jfsh/state.json")
+}
+
+func load() error {
+	if loaded {
+		return nil
+	}
+	p, err := path()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		loaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &current); err != nil {
+		return err
+	}
+	loaded = true
+	return nil
+}
+
+// Returns a copy of the state, the maps too so it can be read while Update writes
+func Get() (State, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	err := load()
+	s := current
+	if s.Volume != nil {
+		volume := *s.Volume
+		s.Volume = &volume
+	}
+	if s.LastEpisode != nil {
+		episode := *s.LastEpisode
+		s.LastEpisode = &episode
+	}
+	s.ItemVolume = maps.Clone(s.ItemVolume)
+	s.Positions = maps.Clone(s.Positions)
+	s.ItemCrop = maps.Clone(s.ItemCrop)
+	s.SeriesTracks = maps.Clone(s.SeriesTracks)
+	s.Downloads = maps.Clone(s.Downloads)
+	return s, err
+}
+
+// Applies update to the state and writes it to disk
+func Update(update func(s *State)) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return err
+	}
+	update(&current)
+	p, err := path()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o600)
+}
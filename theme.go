@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/viper"
+)
+
+// Colors of the TUI, empty ones keep the terminal's or the list's own
+type theme struct {
+	Tab           string `mapstructure:"tab"`
+	ActiveTab     string `mapstructure:"active_tab"`
+	TabText       string `mapstructure:"tab_text"`
+	ActiveTabText string `mapstructure:"active_tab_text"`
+	Selected      string `mapstructure:"selected"`
+	Error         string `mapstructure:"error"`
+	Details       string `mapstructure:"details"`
+}
+
+var themes = map[string]theme{
+	"dark": {
+		Tab:       "#000B25",
+		ActiveTab: "#923FAD",
+		Error:     "#FF5F87",
+		Details:   "#A49FA5",
+	},
+	"light": {
+		Tab:           "#D9DCCF",
+		ActiveTab:     "#923FAD",
+		TabText:       "#1A1A1A",
+		ActiveTabText: "#FFFFFF",
+		Selected:      "#7D2E96",
+		Error:         "#D7005F",
+		Details:       "#5C5C5C",
+	},
+	"high-contrast": {
+		Tab:           "#000000",
+		ActiveTab:     "#FFFF00",
+		TabText:       "#FFFFFF",
+		ActiveTabText: "#000000",
+		Selected:      "#FFFF00",
+		Error:         "#FF0000",
+		Details:       "#FFFFFF",
+	},
+}
+
+var currentTheme = themes["dark"]
+
+// The theme picked in the config with the colors under theme_colors on top
+func loadTheme() theme {
+	name := viper.GetString("theme")
+	t, ok := themes[name]
+	if !ok {
+		if name != "" {
+			slog.Error("unknown theme, using dark", "theme", name)
+		}
+		t = themes["dark"]
+	}
+	// only the colors that are set replace the theme's
+	if err := viper.UnmarshalKey("theme_colors", &t); err != nil {
+		slog.Error("invalid theme_colors", "err", err)
+	}
+	return t
+}
+
+// Has to run before the model is created, the styles are shared by everything
+func applyTheme(t theme) {
+	currentTheme = t
+	inactiveTabColor = lipgloss.Color(t.Tab)
+	activeTabColor = lipgloss.Color(t.ActiveTab)
+	errStyle = errStyle.Foreground(lipgloss.Color(t.Error))
+	detailsStyle = detailsStyle.Foreground(lipgloss.Color(t.Details))
+}
+
+// Tab label colors for the current theme
+func tabColors(active bool) (background, foreground lipgloss.Color) {
+	if active {
+		return activeTabColor, lipgloss.Color(currentTheme.ActiveTabText)
+	}
+	return inactiveTabColor, lipgloss.Color(currentTheme.TabText)
+}
+
+func newDelegate() list.DefaultDelegate {
+	d := list.NewDefaultDelegate()
+	if currentTheme.Selected != "" {
+		selected := lipgloss.Color(currentTheme.Selected)
+		d.Styles.SelectedTitle = d.Styles.SelectedTitle.Foreground(selected).BorderLeftForeground(selected)
+		d.Styles.SelectedDesc = d.Styles.SelectedDesc.Foreground(selected).BorderLeftForeground(selected)
+	}
+	return d
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/hacel/jfsh/jellyfin"
+	"github.com/hacel/jfsh/mpv"
+	"github.com/sj14/jellyfin-go/api"
+)
+
+// Picks the audio and then the subtitle track of an item before it's played
+type trackMenu struct {
+	item      item
+	audio     []api.MediaStream
+	subtitles []api.MediaStream // embedded ones first, like mpv numbers them
+	picked    mpv.Tracks
+	stage     api.MediaStreamType // audio or subtitle
+	cursor    int
+}
+
+func newTrackMenu(i item) *trackMenu {
+	t := &trackMenu{item: i, picked: mpv.Tracks{Audio: -1, Subtitle: -1}, stage: api.MEDIASTREAMTYPE_AUDIO}
+	for _, stream := range jellyfin.GetMediaStreams(jellyfin.Item(i)) {
+		if stream.GetType() == api.MEDIASTREAMTYPE_AUDIO && !stream.GetIsExternal() {
+			t.audio = append(t.audio, stream)
+		}
+	}
+	t.subtitles = append(jellyfin.GetEmbeddedSubtitleStreams(jellyfin.Item(i)), jellyfin.GetExternalSubtitleStreams(jellyfin.Item(i))...)
+	if len(t.audio) < 2 {
+		// nothing to pick
+		t.stage = api.MEDIASTREAMTYPE_SUBTITLE
+	}
+	return t
+}
+
+// Subtitles start with off
+func (t *trackMenu) options() []string {
+	var options []string
+	streams := t.audio
+	if t.stage == api.MEDIASTREAMTYPE_SUBTITLE {
+		options = append(options, "Off")
+		streams = t.subtitles
+	}
+	for _, stream := range streams {
+		options = append(options, streamLabel(stream))
+	}
+	return options
+}
+
+// The display title has the language, codec and channels, the title of the track is often what tells them apart
+func streamLabel(stream api.MediaStream) string {
+	label := stream.GetDisplayTitle()
+	if label == "" {
+		label = strings.TrimSpace(stream.GetLanguage() + " " + stream.GetCodec())
+	}
+	if title := stream.GetTitle(); title != "" && !strings.Contains(label, title) {
+		label += " - " + title
+	}
+	if stream.GetIsExternal() {
+		label += " (external)"
+	}
+	return label
+}
+
+func (t *trackMenu) View() string {
+	heading := "Audio"
+	if t.stage == api.MEDIASTREAMTYPE_SUBTITLE {
+		heading = "Subtitles"
+	}
+	doc := strings.Builder{}
+	fmt.Fprintf(&doc, "%s\n\n%s\n", t.item.Title(), heading)
+	for n, option := range t.options() {
+		cursor := "  "
+		if n == t.cursor {
+			cursor = "> "
+		}
+		doc.WriteString(cursor + option + "\n")
+	}
+	doc.WriteString("\n(enter) Pick (esc) Cancel")
+	return doc.String()
+}
+
+func (m model) updateTrackMenu(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	t := m.trackMenu
+	switch {
+	case msg.String() == "ctrl+c":
+		return m, tea.Quit
+	case msg.String() == "esc" || msg.String() == "q":
+		m.trackMenu = nil
+	case key.Matches(msg, m.keys.Up):
+		t.cursor = max(t.cursor-1, 0)
+	case key.Matches(msg, m.keys.Down):
+		t.cursor = min(t.cursor+1, len(t.options())-1)
+	case msg.String() == "enter":
+		if t.stage == api.MEDIASTREAMTYPE_AUDIO {
+			t.picked.Audio = t.audio[t.cursor].GetIndex()
+			t.stage, t.cursor = api.MEDIASTREAMTYPE_SUBTITLE, 0
+			return m, nil
+		}
+		if t.cursor > 0 {
+			t.picked.Subtitle = t.subtitles[t.cursor-1].GetIndex()
+		}
+		m.trackMenu = nil
+		m.tracks = &t.picked
+		return m.confirmPlay(t.item)
+	}
+	return m, nil
+}
@@ -0,0 +1,64 @@
+// Minimal Trakt scrobble client, https://trakt.docs.apiary.io/#reference/scrobble
+package trakt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const apiUrl = "https://api.trakt.tv"
+
+type Client struct {
+	clientId, token string
+	http            *http.Client
+}
+
+// clientId is the id of a Trakt API app, token an OAuth access token of the user
+func NewClient(clientId, token string) *Client {
+	return &Client{clientId: clientId, token: token, http: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// Movie or episode to scrobble, Ids holds any of imdb, tmdb and tvdb
+type Media struct {
+	Episode bool
+	Ids     map[string]any
+}
+
+// action is start, pause or stop, progress is the percentage watched
+func (c *Client) Scrobble(action string, media Media, progress float64) error {
+	if c == nil {
+		return nil
+	}
+	kind := "movie"
+	if media.Episode {
+		kind = "episode"
+	}
+	body, err := json.Marshal(map[string]any{
+		kind:       map[string]any{"ids": media.Ids},
+		"progress": progress,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, apiUrl+"/scrobble/"+action, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("trakt-api-version", "2")
+	req.Header.Set("trakt-api-key", c.clientId)
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	// 409 means the same scrobble was just sent, nothing to worry about
+	if res.StatusCode >= 300 && res.StatusCode != http.StatusConflict {
+		return fmt.Errorf("trakt scrobble %s: %s", action, res.Status)
+	}
+	return nil
+}
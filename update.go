@@ -1,94 +1,787 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/hacel/jfsh/config"
 	"github.com/hacel/jfsh/jellyfin"
 	"github.com/hacel/jfsh/mpv"
+	"github.com/sj14/jellyfin-go/api"
+	"github.com/spf13/viper"
 )
 
-func (m model) fetchActiveTabItems() tea.Msg {
-	switch m.tabs[m.activeTab] {
-	case "Resume":
-		items, err := m.client.GetResume()
-		if err != nil {
-			return err
+// Tabs with the unwatched filter on get what the server leaves out, or what's left after the played items are dropped
+func (m model) getTabItems(tab string) ([]jellyfin.Item, error) {
+	items, err := m.queryTab(tab)
+	if err != nil || !m.unwatched[tab] {
+		return items, err
+	}
+	// the items might be cached, they're not filtered in place
+	unwatched := []jellyfin.Item{}
+	for _, i := range items {
+		if !item(i).played() {
+			unwatched = append(unwatched, i)
 		}
-		return items
+	}
+	return unwatched, nil
+}
+
+func (m model) queryTab(tab string) ([]jellyfin.Item, error) {
+	filter := m.filter
+	filter.Unwatched = m.unwatched[tab]
+	switch tab {
+	case "Resume":
+		return m.client.GetResume()
 	case "Next Up":
-		items, err := m.client.GetNextUp()
-		if err != nil {
-			return err
-		}
-		return items
+		return m.client.GetNextUp()
 	case "Latest":
-		items, err := m.client.GetLatest()
-		if err != nil {
-			return err
+		return m.client.GetLatest(m.latestLibrary.GetId(), m.sort, m.unwatched[tab])
+	case "Favorites":
+		return m.client.GetFavorites()
+	case "Collections":
+		return m.client.GetCollections()
+	case "Playlists":
+		return m.client.GetPlaylists()
+	case "Library":
+		if len(m.parents) == 0 {
+			// libraries can't be filtered, the filter applies once one is opened
+			return m.client.GetLibraries()
+		}
+		parent := jellyfin.Item(m.parents[len(m.parents)-1].parent)
+		if m.parents[len(m.parents)-1].extras {
+			return m.client.GetExtras(parent)
+		}
+		if m.inSeries() {
+			return m.getSeriesItems(parent)
+		}
+		if parent.GetType() == api.BASEITEMKIND_PLAYLIST {
+			// in their own order, sorting and filtering don't apply
+			return m.client.GetPlaylistItems(parent.GetId())
 		}
-		return items
+		return m.client.GetChildren(parent, filter, m.sort)
+	case "Search":
+		if m.search.Value() == "" {
+			return []jellyfin.Item{}, nil
+		}
+		return m.client.Search(m.search.Value(), filter)
 	default:
 		panic("oops, selected tab is not in switch statement")
 	}
 }
 
+// Items of a tab, tagged with the tab so a late response doesn't end up in another tab
+type tabItems struct {
+	tab   string
+	items []jellyfin.Item
+	err   error
+}
+
+type fetchStarted struct{ tab string }
+
+// fetchStarted arrives first so the spinner shows for as long as the fetch takes
+func (m model) fetchTab(tab string) tea.Cmd {
+	return tea.Sequence(
+		func() tea.Msg { return fetchStarted{tab} },
+		func() tea.Msg {
+			items, err := m.getTabItems(tab)
+			return tabItems{tab, items, err}
+		},
+	)
+}
+
+func (m model) fetchActiveTabItems() tea.Msg {
+	return m.fetchTab(m.tabs[m.activeTab])()
+}
+
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case error:
-		m.err = msg
+		slog.Error("request failed", "err", msg)
+		m.err = m.describeErr(msg)
+		m.updateListSize()
 
-	case []jellyfin.Item:
-		// Cast to item to hand off to list.Model
-		items := []list.Item{}
-		for _, i := range msg {
-			items = append(items, item(i))
+	case fetchStarted:
+		m.loading[msg.tab]++
+		cmd := m.spin()
+		return m, cmd
+
+	case spinner.TickMsg:
+		if !m.busy() {
+			m.spinning = false
+			return m, nil
 		}
-		return m, m.list.SetItems(items)
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case tabItems:
+		m.loading[msg.tab]--
+		m.tabErrs[msg.tab] = msg.err
+		if msg.err == nil {
+			m.tabCache[msg.tab] = msg.items
+		}
+		if msg.tab != m.tabs[m.activeTab] {
+			// prefetched, shown when switching to it
+			return m, nil
+		}
+		if msg.err != nil {
+			slog.Error("failed to fetch tab", "tab", msg.tab, "err", msg.err)
+			m.err = m.describeErr(msg.err)
+			m.updateListSize()
+			return m, nil
+		}
+		return m, m.setItems(msg.items)
+
+	case imageLoaded:
+		m.images[msg.id] = msg.image
+
+	case remainingLoaded:
+		m.remaining[msg.seriesId] = msg.remaining
 
 	case tea.WindowSizeMsg:
-		m.list.SetSize(
-			msg.Width-docStyle.GetHorizontalFrameSize(),
-			msg.Height-docStyle.GetVerticalFrameSize()-tabStyle.GetVerticalFrameSize()-1, // 1 for \n
-		)
+		m.width, m.height = msg.Width, msg.Height
+		m.help.Width = msg.Width - docStyle.GetHorizontalFrameSize()
+		m.updateListSize()
+
+	case searchDebounced:
+		if msg.seq != m.searchSeq {
+			// another key was pressed since
+			return m, nil
+		}
+		m.list.ResetSelected()
+		return m, m.fetchActiveTabItems
+
+	case genresLoaded:
+		m.genres = msg
+		return m.cycleGenre()
+
+	case librariesLoaded:
+		m.libraries = msg
+		return m.cycleLibrary()
+
+	case downloadTicked:
+		if len(m.downloads) == 0 {
+			return m, nil
+		}
+		return m, tea.Batch(m.list.NewStatusMessage(m.describeDownloads()), tickDownloads())
+
+	case downloadFinished:
+		delete(m.downloads, msg.id)
+		if msg.err != nil {
+			m.err = fmt.Errorf("failed to download %s: %w", msg.title, msg.err)
+			m.updateListSize()
+			return m, nil
+		}
+		return m, m.list.NewStatusMessage("Downloaded " + msg.title)
+
+	case continueFound:
+		if msg.episode == nil {
+			return m, m.list.NewStatusMessage("Nothing to continue")
+		}
+		i := item(*msg.episode)
+		return m.play(i, mpv.GetResumeStart(*msg.episode), viper.GetBool("autoqueue"))
+
+	case randomFound:
+		if msg.item == nil {
+			return m, m.list.NewStatusMessage("Everything in there was watched")
+		}
+		return m.play(item(*msg.item), mpv.GetResumeStart(*msg.item), false)
+
+	case linkResolved:
+		i := item(msg.item)
+		if i.isFolder() {
+			return m.browse(browseLevel{parent: i, selected: m.list.Index()})
+		}
+		m.queue = viper.GetBool("autoqueue")
+		m.pickTracks, m.tracks = false, nil
+		return m.startPlay(i)
+
+	case seasonMarked:
+		// every episode changed
+		m.client.InvalidateCache()
+		return m, m.fetchActiveTabItems
+
+	case itemUpdated:
+		m.client.InvalidateCache()
+		for index, listItem := range m.list.Items() {
+			if i, ok := listItem.(item); ok && i.Id != nil && *i.Id == msg.id {
+				return m, m.list.SetItem(index, msg.update(i))
+			}
+		}
 
 	case playbackStopped:
 		m.playing = nil
-		return m, m.fetchActiveTabItems
+		clear(m.remaining)
+		m.client.InvalidateCache() // positions and played states changed
+		if msg.err != nil {
+			m.err = msg.err
+		}
+		m.summary = msg.summary.String()
+		m.updateListSize()
+		// these are the ones that moved on, they're fresh when switching to them
+		cmds := []tea.Cmd{m.fetchActiveTabItems}
+		for _, tab := range []string{"Resume", "Next Up"} {
+			if tab != m.tabs[m.activeTab] {
+				cmds = append(cmds, m.fetchTab(tab))
+			}
+		}
+		return m, tea.Batch(cmds...)
 
 	case tea.KeyMsg:
+		if m.summary != "" {
+			// it's been read
+			m.summary = ""
+			m.updateListSize()
+		}
+		if m.playQueue.open {
+			return m.updateQueue(msg)
+		}
+		if m.pickVersion != nil {
+			return m.updatePickVersion(msg)
+		}
+		if m.trackMenu != nil {
+			return m.updateTrackMenu(msg)
+		}
+		if m.confirmResume != nil {
+			return m.updateConfirmResume(msg)
+		}
+		if m.showHelp {
+			// any key closes the help
+			m.showHelp = false
+			return m, nil
+		}
 		if m.list.SettingFilter() {
 			break
 		}
-		switch msg.String() {
-		case "left", "h":
+		if m.search.Focused() {
+			return m.updateSearch(msg)
+		}
+		switch {
+		case key.Matches(msg, m.keys.PrevTab):
 			if m.activeTab > 0 {
 				m.activeTab--
 			}
-			m.list.ResetSelected()
-			return m, m.fetchActiveTabItems
-		case "right", "l":
+			return m.switchTab()
+		case key.Matches(msg, m.keys.NextTab):
 			if m.activeTab < len(m.tabs)-1 {
 				m.activeTab++
 			}
+			return m.switchTab()
+		case key.Matches(msg, m.keys.Search):
+			if m.tabs[m.activeTab] == "Search" {
+				return m, m.search.Focus()
+			}
+		case key.Matches(msg, m.keys.Back):
+			// esc also clears the list filter
+			if m.tabs[m.activeTab] != "Library" || len(m.parents) == 0 || m.list.IsFiltered() {
+				break
+			}
+			m.restored = m.parents[len(m.parents)-1].selected
+			m.parents = m.parents[:len(m.parents)-1]
 			m.list.ResetSelected()
 			return m, m.fetchActiveTabItems
-		case "enter", "space":
+		case key.Matches(msg, m.keys.Play), key.Matches(msg, m.keys.PlayAlt):
+			if header, ok := m.list.SelectedItem().(seasonHeader); ok {
+				return m.toggleSeason(header)
+			}
 			item, ok := m.list.SelectedItem().(item)
 			if !ok {
-				panic("failed casting list.Item to `item`")
+				// empty list
+				break
+			}
+			if item.isFolder() {
+				return m.browse(browseLevel{parent: item, selected: m.list.Index()})
 			}
-			m.playing = &item
+			// extras play on their own
+			m.queue = viper.GetBool("autoqueue") != key.Matches(msg, m.keys.PlayAlt) && !m.inExtras()
+			m.pickTracks, m.tracks = false, nil
+			return m.startPlay(item)
+		case key.Matches(msg, m.keys.Tracks):
+			selected, ok := m.list.SelectedItem().(item)
+			if !ok || selected.isFolder() {
+				break
+			}
+			m.queue = viper.GetBool("autoqueue") && !m.inExtras()
+			m.pickTracks, m.tracks = true, nil
+			return m.startPlay(selected)
+		case key.Matches(msg, m.keys.Continue):
+			return m, m.findContinue
+		case key.Matches(msg, m.keys.Random):
+			return m.playRandom()
+		case key.Matches(msg, m.keys.Similar):
+			return m.playSimilar()
+		case key.Matches(msg, m.keys.Enqueue):
+			return m.toggleQueued()
+		case key.Matches(msg, m.keys.Queue):
+			return m.openQueue()
+		case key.Matches(msg, m.keys.Extras):
+			selected, ok := m.list.SelectedItem().(item)
+			if !ok || m.inExtras() {
+				break
+			}
+			switch *selected.Type {
+			case api.BASEITEMKIND_MOVIE, api.BASEITEMKIND_SERIES:
+				return m.browse(browseLevel{parent: selected, selected: m.list.Index(), extras: true})
+			}
+			return m, m.list.NewStatusMessage("Only movies and series have extras")
+		case key.Matches(msg, m.keys.Watched):
+			if header, ok := m.list.SelectedItem().(seasonHeader); ok {
+				return m.markSeason(header)
+			}
+			selected, ok := m.list.SelectedItem().(item)
+			if !ok {
+				break
+			}
+			played := !selected.played()
 			return m, func() tea.Msg {
-				mpv.Play(m.client, jellyfin.Item(item))
-				return playbackStopped{}
+				mark := m.client.MarkPlayed
+				if !played {
+					mark = m.client.MarkUnplayed
+				}
+				if err := mark(jellyfin.Item(selected)); err != nil {
+					return err
+				}
+				return itemUpdated{*selected.Id, func(i item) item { return i.withPlayed(played) }}
+			}
+		case key.Matches(msg, m.keys.Favorite):
+			selected, ok := m.list.SelectedItem().(item)
+			if !ok {
+				break
+			}
+			favorite := !selected.favorite()
+			return m, func() tea.Msg {
+				if err := m.client.SetFavorite(jellyfin.Item(selected), favorite); err != nil {
+					return err
+				}
+				return itemUpdated{*selected.Id, func(i item) item { return i.withFavorite(favorite) }}
+			}
+		case key.Matches(msg, m.keys.Download):
+			return m.startDownload()
+		case key.Matches(msg, m.keys.Shuffle):
+			shuffle := !viper.GetBool("shuffle")
+			status := "Shuffle off"
+			if shuffle {
+				status = "Shuffle on"
+			}
+			return m, m.list.NewStatusMessage(saveSetting(status, map[string]any{"shuffle": shuffle}))
+		case key.Matches(msg, m.keys.Repeat):
+			modes := []string{"off", "all", "one"}
+			mode := modes[(slices.Index(modes, viper.GetString("repeat"))+1)%len(modes)]
+			return m, m.list.NewStatusMessage(saveSetting("Repeat "+mode, map[string]any{"repeat": mode}))
+		case key.Matches(msg, m.keys.Genre), key.Matches(msg, m.keys.Type):
+			if !m.filterable() {
+				return m, m.list.NewStatusMessage("Filters only apply to Search and Library")
 			}
-		case "ctrl+c", "q":
+			if key.Matches(msg, m.keys.Type) {
+				return m.cycleType()
+			}
+			if m.genres == nil {
+				return m, m.fetchGenres
+			}
+			return m.cycleGenre()
+		case key.Matches(msg, m.keys.Unwatched):
+			return m.toggleUnwatched()
+		case key.Matches(msg, m.keys.Library):
+			if m.tabs[m.activeTab] != "Latest" {
+				return m, m.list.NewStatusMessage("Picking a library only applies to Latest")
+			}
+			if m.libraries == nil {
+				return m, m.fetchLibraries
+			}
+			return m.cycleLibrary()
+		case key.Matches(msg, m.keys.Sort), key.Matches(msg, m.keys.SortOrder):
+			if !m.sortable() {
+				return m, m.list.NewStatusMessage("Sorting only applies to Latest and Library")
+			}
+			sort := m.sort
+			if key.Matches(msg, m.keys.SortOrder) {
+				sort.Descending = !sort.Descending
+			} else {
+				sort.By = sortOptions[(slices.Index(sortOptions, sort.By)+1)%len(sortOptions)]
+			}
+			return m.setSort(sort)
+		case key.Matches(msg, m.keys.Quality):
+			next := (slices.IndexFunc(qualityPresets, func(q qualityPreset) bool {
+				return q.bitrate == viper.GetInt("max_bitrate")
+			}) + 1) % len(qualityPresets)
+			status := saveSetting("Quality "+qualityPresets[next].name, map[string]any{"max_bitrate": qualityPresets[next].bitrate})
+			return m, m.list.NewStatusMessage(status)
+		case key.Matches(msg, m.keys.Refresh):
+			m.client.InvalidateCache()
+			return m, m.fetchActiveTabItems
+		case key.Matches(msg, m.keys.Help):
+			m.showHelp = true
+			return m, nil
+		case key.Matches(msg, m.keys.Quit):
 			return m, tea.Quit
 		}
 	}
 	var cmd tea.Cmd
 	m.list, cmd = m.list.Update(msg)
-	return m, cmd
+	return m, tea.Batch(cmd, m.fetchImage(), m.fetchRemaining())
+}
+
+// Timeouts get a hint that trying again might work
+// Saves settings changed from the TUI, they still apply until jfsh exits if that fails
+func saveSetting(status string, values map[string]any) string {
+	if err := config.Save(values); err != nil {
+		slog.Error("failed to save config", "err", err)
+		return status + ", but it couldn't be saved: " + err.Error()
+	}
+	return status
+}
+
+func (m model) describeErr(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("the server took too long to respond, press %s to try again: %w", m.keys.Refresh.Help().Key, err)
+	}
+	return err
+}
+
+// Bitrates the quality key cycles through, a custom max_bitrate starts over at the first
+type qualityPreset struct {
+	name    string
+	bitrate int
+}
+
+var qualityPresets = []qualityPreset{
+	{"original", 0},
+	{"1080p", 8_000_000},
+	{"720p", 4_000_000},
+	{"480p", 1_500_000},
+}
+
+type playbackStopped struct {
+	summary mpv.Summary
+	err     error
+}
+
+type searchDebounced struct{ seq int }
+
+// Episodes are played with the rest of their series queued around them, unless queue is off.
+// Inside a collection or playlist the rest of it is queued instead, if the item is in it
+func (m model) play(i item, start int64, queue bool) (tea.Model, tea.Cmd) {
+	return m.playTracks(i, start, queue, nil)
+}
+
+// play with the tracks picked in the track menu, nil to select them as usual
+func (m model) playTracks(i item, start int64, queue bool, tracks *mpv.Tracks) (tea.Model, tea.Cmd) {
+	m.playing = &i
+	spin := m.spin()
+	source, inList := m.openList()
+	return m, tea.Batch(spin, func() tea.Msg {
+		items := []jellyfin.Item{jellyfin.Item(i)}
+		index := 0
+		if queue && inList {
+			if children, err := m.getTabItems("Library"); err != nil {
+				slog.Error("failed to get items of "+source.GetName(), "err", err)
+			} else {
+				// nested series and folders can't be played
+				playable := slices.DeleteFunc(slices.Clone(children), func(c jellyfin.Item) bool { return item(c).isFolder() })
+				if n := slices.IndexFunc(playable, func(c jellyfin.Item) bool { return c.GetId() == *i.Id }); n >= 0 {
+					items, index = playable, n
+				}
+			}
+		}
+		if queue && len(items) == 1 && *i.Type == api.BASEITEMKIND_EPISODE {
+			if episodes, err := m.client.GetEpisodes(jellyfin.Item(i)); err != nil {
+				slog.Error("failed to get episodes", "err", err)
+			} else if n := slices.IndexFunc(episodes, func(e jellyfin.Item) bool { return e.GetId() == *i.Id }); n >= 0 {
+				items, index = slices.Clone(episodes), n // cached, the picked version mustn't end up in there
+			}
+		}
+		items[index].MediaSources = i.MediaSources // the queue comes from the server, without the version that was picked
+		summary, err := mpv.Play(m.client, items, index, start, tracks)
+		return playbackStopped{summary, err}
+	})
+}
+
+// The highlighted movie followed by the ones the server finds similar to it
+func (m model) playSimilar() (tea.Model, tea.Cmd) {
+	selected, ok := m.list.SelectedItem().(item)
+	if !ok || *selected.Type != api.BASEITEMKIND_MOVIE {
+		return m, m.list.NewStatusMessage("Only movies have similar ones for now")
+	}
+	m.playing = &selected
+	spin := m.spin()
+	return m, tea.Batch(spin, func() tea.Msg {
+		similar, err := m.client.GetSimilar(jellyfin.Item(selected))
+		if err != nil {
+			return playbackStopped{err: err}
+		}
+		items := append([]jellyfin.Item{jellyfin.Item(selected)}, similar...)
+		summary, err := mpv.Play(m.client, items, 0, mpv.GetResumeStart(jellyfin.Item(selected)), nil)
+		return playbackStopped{summary, err}
+	})
+}
+
+// Item a pasted link points to, checked with the server first
+type linkResolved struct{ item jellyfin.Item }
+
+func (m model) resolveLink(id string) tea.Cmd {
+	return func() tea.Msg {
+		i, err := m.client.GetItem(id)
+		if err != nil {
+			return fmt.Errorf("failed to get item %q: %w", id, err)
+		}
+		return linkResolved{i}
+	}
+}
+
+// Episode to continue with, nil if there's none
+type continueFound struct{ episode *jellyfin.Item }
+
+// The episode playback last stopped on, or the one after it if it was watched to the end
+func (m model) findContinue() tea.Msg {
+	seriesId, episodeId, ok := mpv.GetLastEpisode()
+	if !ok {
+		return continueFound{}
+	}
+	episodes, err := m.client.GetSeriesEpisodes(seriesId)
+	if err != nil {
+		return err
+	}
+	n := slices.IndexFunc(episodes, func(e jellyfin.Item) bool { return e.GetId() == episodeId })
+	if n < 0 {
+		return continueFound{}
+	}
+	if item(episodes[n]).played() {
+		n++
+	}
+	if n >= len(episodes) {
+		return continueFound{}
+	}
+	return continueFound{&episodes[n]}
+}
+
+// Opens a level in the library, items from other tabs are opened there too
+func (m model) browse(level browseLevel) (tea.Model, tea.Cmd) {
+	if m.tabs[m.activeTab] != "Library" {
+		// e.g. a favorite series, a collection or a playlist
+		m.activeTab = slices.Index(m.tabs, "Library")
+		m.parents = nil
+		// the index is in the other tab, going back up starts at the top of Library
+		level.selected = 0
+		m.search.Blur()
+		m.updateListSize()
+	}
+	m.parents = append(m.parents, level)
+	m.list.ResetSelected()
+	m.list.ResetFilter()
+	return m, m.fetchActiveTabItems
+}
+
+func (m model) inExtras() bool {
+	return m.tabs[m.activeTab] == "Library" && len(m.parents) > 0 && m.parents[len(m.parents)-1].extras
+}
+
+// Random item to play, nil if there's none
+type randomFound struct{ item *jellyfin.Item }
+
+// Picks from the highlighted series, season or library, or from the one that's open
+func (m model) playRandom() (tea.Model, tea.Cmd) {
+	var parent item
+	switch selected := m.list.SelectedItem().(type) {
+	case seasonHeader:
+		parent = selected.season
+	case item:
+		if selected.isFolder() {
+			parent = selected
+		}
+	}
+	if parent.Id == nil && m.tabs[m.activeTab] == "Library" && len(m.parents) > 0 {
+		parent = m.parents[len(m.parents)-1].parent
+	}
+	if parent.Id == nil {
+		return m, m.list.NewStatusMessage("Highlight a series or library to pick from")
+	}
+	return m, func() tea.Msg {
+		random, ok, err := m.client.GetRandomUnplayed(jellyfin.Item(parent))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return randomFound{}
+		}
+		return randomFound{&random}
+	}
+}
+
+// The collection or playlist open in the library, if that's where the selection is
+func (m model) openList() (jellyfin.Item, bool) {
+	if m.tabs[m.activeTab] != "Library" || len(m.parents) == 0 {
+		return jellyfin.Item{}, false
+	}
+	parent := jellyfin.Item(m.parents[len(m.parents)-1].parent)
+	switch parent.GetType() {
+	case api.BASEITEMKIND_BOX_SET, api.BASEITEMKIND_PLAYLIST:
+		return parent, true
+	}
+	return jellyfin.Item{}, false
+}
+
+// Asks for the version first with media_version ask, then goes on to the track menu if it was asked for
+func (m model) startPlay(i item) (tea.Model, tea.Cmd) {
+	if viper.GetString("media_version") == "ask" && len(i.MediaSources) > 1 {
+		m.pickVersion = &i
+		return m, nil
+	}
+	return m.openTrackMenu(i)
+}
+
+func (m model) openTrackMenu(i item) (tea.Model, tea.Cmd) {
+	if !m.pickTracks {
+		return m.confirmPlay(i)
+	}
+	m.trackMenu = newTrackMenu(i)
+	return m, nil
+}
+
+// Asks whether to resume first if there's a position to resume from
+func (m model) confirmPlay(i item) (tea.Model, tea.Cmd) {
+	if mpv.GetResumePosition(jellyfin.Item(i)) > 0 {
+		m.confirmResume = &i
+		return m, nil
+	}
+	return m.playTracks(i, 0, m.queue, m.tracks)
+}
+
+// Versions are picked by their number, there's rarely more than a few
+func (m model) updatePickVersion(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	i := *m.pickVersion
+	switch msg.String() {
+	case "esc", "q":
+		m.pickVersion = nil
+		return m, nil
+	case "ctrl+c":
+		return m, tea.Quit
+	}
+	n, err := strconv.Atoi(msg.String())
+	if err != nil || n < 1 || n > len(i.MediaSources) {
+		return m, nil
+	}
+	m.pickVersion = nil
+	return m.openTrackMenu(item(jellyfin.WithVersion(jellyfin.Item(i), i.MediaSources[n-1].GetId())))
+}
+
+func (m model) updateConfirmResume(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	i := *m.confirmResume
+	switch msg.String() {
+	case "enter", "r":
+		m.confirmResume = nil
+		return m.playTracks(i, mpv.GetResumeStart(jellyfin.Item(i)), m.queue, m.tracks)
+	case "s", "b":
+		m.confirmResume = nil
+		return m.playTracks(i, 0, m.queue, m.tracks)
+	case "esc", "q":
+		m.confirmResume = nil
+	case "ctrl+c":
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+// Changes the list entry of an item after the server accepted the change
+type itemUpdated struct {
+	id     string
+	update func(item) item
 }
 
-type playbackStopped struct{}
+// Leaves room for the search input or the library path and errors
+func (m *model) updateListSize() {
+	height := m.height - docStyle.GetVerticalFrameSize() - tabStyle.GetVerticalFrameSize() - 1 // 1 for \n
+	switch m.tabs[m.activeTab] {
+	case "Search", "Library":
+		height -= 2 // search input or path, and \n
+	}
+	if m.err != nil {
+		height -= 2 // error and \n
+	}
+	if m.summary != "" {
+		height -= 2 // summary and \n
+	}
+	height -= detailsHeight
+	height -= 2 // short help and \n
+	width := m.width - docStyle.GetHorizontalFrameSize()
+	if m.images != nil {
+		width -= imageWidth + 2 // artwork and a gap
+	}
+	m.list.SetSize(width, height)
+}
+
+// Cast to item to hand off to list.Model
+func (m *model) setItems(msg []jellyfin.Item) tea.Cmd {
+	items := []list.Item{}
+	if m.inSeries() {
+		items = m.groupSeasons(msg)
+	} else {
+		for _, i := range msg {
+			items = append(items, item(i))
+		}
+	}
+	m.err = nil
+	m.updateListSize()
+	cmd := m.list.SetItems(items)
+	if m.restored > 0 {
+		m.list.Select(m.restored)
+		m.restored = 0
+	}
+	return tea.Batch(cmd, m.fetchImage(), m.fetchRemaining())
+}
+
+// Shows what was fetched for the tab before right away, fresh items replace it when they arrive
+func (m model) switchTab() (tea.Model, tea.Cmd) {
+	m.list.ResetSelected()
+	m.updateListSize()
+	var cmd tea.Cmd
+	if items, ok := m.tabCache[m.tabs[m.activeTab]]; ok {
+		cmd = m.setItems(items)
+	} else {
+		cmd = m.list.SetItems(nil)
+	}
+	if m.tabs[m.activeTab] == "Search" {
+		cmd = tea.Batch(cmd, m.search.Focus())
+	} else {
+		m.search.Blur()
+	}
+	return m, tea.Batch(cmd, m.fetchActiveTabItems)
+}
+
+// Keys go to the search input until it's left with enter, esc or down
+func (m model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "enter":
+		m.search.Blur()
+		// a pasted link plays the item instead of searching for it
+		if id, ok := jellyfin.ParseItemLink(m.search.Value()); ok {
+			return m, m.resolveLink(id)
+		}
+		return m, nil
+	case "esc", "down", "tab":
+		m.search.Blur()
+		return m, nil
+	}
+	query := m.search.Value()
+	var cmd tea.Cmd
+	m.search, cmd = m.search.Update(msg)
+	if m.search.Value() == query {
+		return m, cmd
+	}
+	m.searchSeq++
+	seq := m.searchSeq
+	return m, tea.Batch(cmd, tea.Tick(300*time.Millisecond, func(time.Time) tea.Msg {
+		return searchDebounced{seq}
+	}))
+}
@@ -4,33 +4,125 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/hacel/jfsh/jellyfin"
+	"github.com/hacel/jfsh/mpv"
 )
 
+// Colors come from the theme, see applyTheme
 var (
 	inactiveTabColor = lipgloss.Color("#000B25")
 	activeTabColor   = lipgloss.Color("#923FAD")
 	docStyle         = lipgloss.NewStyle().Margin(2)
 	tabStyle         = lipgloss.NewStyle().Margin(0, 1, 1, 1).Padding(0, 2)
+	errStyle         = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF5F87"))
+	detailsStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("#A49FA5"))
 )
 
 func (m model) View() string {
 	if m.playing != nil {
-		return docStyle.Render(fmt.Sprintf("Now playing %q\nExit mpv to return to menu", m.playing.Title()))
+		return docStyle.Render(fmt.Sprintf("%s Now playing %q\nExit mpv to return to menu", m.spinner.View(), m.playing.Title()))
+	}
+
+	if m.pickVersion != nil {
+		versions := m.pickVersion.Title() + "\n\n"
+		for n, source := range m.pickVersion.MediaSources {
+			versions += fmt.Sprintf("(%d) %s\n", n+1, jellyfin.VersionName(source))
+		}
+		return docStyle.Render(versions + "(esc) Cancel")
+	}
+
+	if m.playQueue.open {
+		return docStyle.Render(m.playQueue.View(m.keys))
+	}
+
+	if m.trackMenu != nil {
+		return docStyle.Render(m.trackMenu.View())
+	}
+
+	if m.confirmResume != nil {
+		pos := mpv.GetResumePosition(jellyfin.Item(*m.confirmResume))
+		return docStyle.Render(fmt.Sprintf("%s\n\n(r) Resume from %s\n(s) Start from the beginning\n(esc) Cancel", m.confirmResume.Title(), formatDuration(pos)))
+	}
+
+	if m.showHelp {
+		l := m.list.KeyMap
+		bindings := append(m.keys.FullHelp(), []key.Binding{l.Filter, l.ClearFilter, l.PrevPage, l.NextPage, l.GoToStart, l.GoToEnd})
+		return docStyle.Render("Keybindings\n\n" + m.help.FullHelpView(bindings) + "\n\nPress any key to close")
 	}
 
 	doc := strings.Builder{}
 	var tabs []string
 	for i, name := range m.tabs {
-		color := inactiveTabColor
-		if i == m.activeTab {
-			color = activeTabColor
+		background, foreground := tabColors(i == m.activeTab)
+		label := name
+		if m.tabErrs[name] != nil {
+			label += " !"
+		}
+		style := tabStyle.Background(background)
+		if foreground != "" {
+			style = style.Foreground(foreground)
 		}
-		tabs = append(tabs, tabStyle.Background(color).Render(name))
+		tabs = append(tabs, style.Render(label))
+	}
+	if m.loading[m.tabs[m.activeTab]] > 0 {
+		tabs = append(tabs, m.spinner.View())
 	}
 	row := lipgloss.JoinHorizontal(lipgloss.Top, tabs...)
 	doc.WriteString(row)
 	doc.WriteString("\n")
-	doc.WriteString(m.list.View())
+	if m.err != nil {
+		doc.WriteString(errStyle.Render(jellyfin.Redact(m.err.Error())))
+		doc.WriteString("\n\n")
+	}
+	if m.summary != "" {
+		doc.WriteString(detailsStyle.Render(m.summary))
+		doc.WriteString("\n\n")
+	}
+	filter := m.filter
+	filter.Unwatched = m.unwatched[m.tabs[m.activeTab]]
+	filterDesc := describeFilter(filter)
+	switch m.tabs[m.activeTab] {
+	case "Search":
+		doc.WriteString(m.search.View())
+		if filterDesc != "" {
+			doc.WriteString(" " + filterDesc)
+		}
+		doc.WriteString("\n\n")
+	case "Library":
+		path := []string{"Library"}
+		for _, level := range m.parents {
+			path = append(path, level.parent.Title())
+			if level.extras {
+				path = append(path, "Extras")
+			}
+		}
+		doc.WriteString(strings.Join(path, " / "))
+		if filterDesc != "" {
+			doc.WriteString(" " + filterDesc)
+		}
+		doc.WriteString("\n\n")
+	}
+	if image := m.selectedImage(); image != "" {
+		doc.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, m.list.View(), "  ", image))
+	} else {
+		doc.WriteString(m.list.View())
+	}
+	if selected, ok := m.list.SelectedItem().(item); ok {
+		doc.WriteString("\n\n")
+		doc.WriteString(detailsStyle.Render(selected.details(m.width-docStyle.GetHorizontalFrameSize(), m.selectedRemaining())))
+	}
+	doc.WriteString("\n\n")
+	doc.WriteString(m.help.View(m.keys))
 	return docStyle.Render(doc.String())
 }
+
+// h:mm:ss or m:ss
+func formatDuration(secs int64) string {
+	h, m, s := secs/3600, secs/60%60, secs%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}